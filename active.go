@@ -0,0 +1,45 @@
+package querypulse
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// ActiveQuery describes a query that is being run by the wrapped driver.
+type ActiveQuery struct {
+	Query string
+	// TxID identifies the transaction the query is part of. It is zero outside of a transaction.
+	TxID uint64
+}
+
+// Fingerprint returns the Fingerprint of the query.
+func (q ActiveQuery) Fingerprint() string {
+	return Fingerprint(q.Query)
+}
+
+type activeQueryKey struct{}
+
+// QueryFromContext returns the query in flight for a context passed to the
+// wrapped driver. Drivers and code they call, such as notice handlers, can use
+// it to tell which query they are working on. Contexts created by the
+// application never hold a query.
+func QueryFromContext(ctx context.Context) (ActiveQuery, bool) {
+	q, ok := ctx.Value(activeQueryKey{}).(ActiveQuery)
+	return q, ok
+}
+
+func withActiveQuery(ctx context.Context, q ActiveQuery) context.Context {
+	return context.WithValue(ctx, activeQueryKey{}, q)
+}
+
+var txIDs atomic.Uint64
+
+func nextTxID() uint64 {
+	return txIDs.Add(1)
+}
+
+var connIDs atomic.Uint64
+
+func nextConnID() uint64 {
+	return connIDs.Add(1)
+}
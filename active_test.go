@@ -0,0 +1,55 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ctxConn is a driver.Conn that remembers the context it was last given.
+type ctxConn struct {
+	ctx context.Context
+}
+
+func (c *ctxConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *ctxConn) Close() error                              { return nil }
+func (c *ctxConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *ctxConn) Commit() error                             { return nil }
+func (c *ctxConn) Rollback() error                           { return nil }
+
+func (c *ctxConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.ctx = ctx
+	return driver.RowsAffected(0), nil
+}
+
+func TestQueryFromContext(t *testing.T) {
+	parent := &ctxConn{}
+	conn := WrapConn(parent, Options{}).(*zConn)
+
+	_, ok := QueryFromContext(ctx)
+	assert.False(t, ok)
+
+	_, err := conn.ExecContext(ctx, "select $1", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}})
+	assert.NoError(t, err)
+
+	q, ok := QueryFromContext(parent.ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "select $1", q.Query)
+	assert.Equal(t, "select ?", q.Fingerprint())
+	assert.Equal(t, uint64(0), q.TxID)
+
+	tx, err := conn.BeginTx(ctx, driver.TxOptions{})
+	assert.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "select 1", nil)
+	assert.NoError(t, err)
+	q, _ = QueryFromContext(parent.ctx)
+	assert.NotZero(t, q.TxID)
+	assert.NoError(t, tx.Commit())
+
+	_, err = conn.ExecContext(ctx, "select 1", nil)
+	assert.NoError(t, err)
+	q, _ = QueryFromContext(parent.ctx)
+	assert.Zero(t, q.TxID)
+}
@@ -0,0 +1,186 @@
+package querypulse
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Budget counts the queries and database time of a scope such as an HTTP
+// request. Create one with WithBudget or WithStrictBudget and read it at the
+// end of the scope with BudgetFromContext.
+//
+// Budgets nest. A query counts towards every budget of its context.
+type Budget struct {
+	maxQueries int
+	maxDBTime  time.Duration
+	strict     bool
+	parent     *Budget
+
+	mu       sync.Mutex
+	queries  int
+	dbTime   time.Duration
+	slowest  Event
+	rejected int
+	exceeded bool
+	counts   map[string]int
+}
+
+// BudgetSummary is what a Budget has counted so far.
+type BudgetSummary struct {
+	Queries int
+	DBTime  time.Duration
+	// Slowest is the query that took the longest. It is empty when no queries have run.
+	Slowest         string
+	SlowestDuration time.Duration
+	// Rejected counts the queries a strict budget stopped.
+	Rejected int
+	// Fingerprints counts the queries run per Fingerprint. A fingerprint run
+	// many times in one scope is often an N+1 query.
+	Fingerprints map[string]int
+	// Exceeded is true once the scope ran more queries or used more database
+	// time than allowed.
+	Exceeded   bool
+	MaxQueries int
+	MaxDBTime  time.Duration
+}
+
+// BudgetError is returned for queries run with a strict budget that is used up.
+type BudgetError struct {
+	Query      string
+	Queries    int
+	DBTime     time.Duration
+	MaxQueries int
+	MaxDBTime  time.Duration
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("querypulse: query budget exceeded after %d queries and %s: %s", e.Queries, e.DBTime, e.Query)
+}
+
+type budgetKey struct{}
+
+// WithBudget returns a context that counts the queries run with it.
+// Options.OnBudgetExceeded is called once the scope runs more than maxQueries
+// queries or uses more than maxDBTime of database time. Zero leaves a limit off.
+func WithBudget(ctx context.Context, maxQueries int, maxDBTime time.Duration) context.Context {
+	return withBudget(ctx, maxQueries, maxDBTime, false)
+}
+
+// WithStrictBudget is like WithBudget but once the budget is used up further
+// queries are rejected with a *BudgetError instead of being run.
+func WithStrictBudget(ctx context.Context, maxQueries int, maxDBTime time.Duration) context.Context {
+	return withBudget(ctx, maxQueries, maxDBTime, true)
+}
+
+func withBudget(ctx context.Context, maxQueries int, maxDBTime time.Duration, strict bool) context.Context {
+	parent, _ := BudgetFromContext(ctx)
+	b := &Budget{maxQueries: maxQueries, maxDBTime: maxDBTime, strict: strict, parent: parent}
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// BudgetFromContext returns the innermost Budget of a context.
+func BudgetFromContext(ctx context.Context) (*Budget, bool) {
+	b, ok := ctx.Value(budgetKey{}).(*Budget)
+	return b, ok
+}
+
+// Summary returns what the budget has counted so far.
+func (b *Budget) Summary() BudgetSummary {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := make(map[string]int, len(b.counts))
+	for fingerprint, n := range b.counts {
+		counts[fingerprint] = n
+	}
+	return BudgetSummary{
+		Queries:         b.queries,
+		DBTime:          b.dbTime,
+		Slowest:         b.slowest.Query,
+		SlowestDuration: b.slowest.Duration,
+		Rejected:        b.rejected,
+		Fingerprints:    counts,
+		Exceeded:        b.exceeded,
+		MaxQueries:      b.maxQueries,
+		MaxDBTime:       b.maxDBTime,
+	}
+}
+
+func (b *Budget) usedUp() bool {
+	return (b.maxQueries > 0 && b.queries >= b.maxQueries) || (b.maxDBTime > 0 && b.dbTime >= b.maxDBTime)
+}
+
+func (b *Budget) over() bool {
+	return (b.maxQueries > 0 && b.queries > b.maxQueries) || (b.maxDBTime > 0 && b.dbTime > b.maxDBTime)
+}
+
+// reject returns a *BudgetError when a strict budget has nothing left for
+// another query. first is true the first time the budget is exceeded.
+func (b *Budget) reject(query string) (first bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.strict || !b.usedUp() {
+		return false, nil
+	}
+	b.rejected++
+	first = !b.exceeded
+	b.exceeded = true
+	return first, &BudgetError{Query: query, Queries: b.queries, DBTime: b.dbTime, MaxQueries: b.maxQueries, MaxDBTime: b.maxDBTime}
+}
+
+// spend counts a query. It returns true the first time the budget is exceeded.
+func (b *Budget) spend(ev Event) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queries++
+	b.dbTime += ev.Duration
+	if b.counts == nil {
+		b.counts = map[string]int{}
+	}
+	b.counts[ev.Fingerprint]++
+	if b.slowest.Query == "" || ev.Duration > b.slowest.Duration {
+		b.slowest = ev
+	}
+	if b.exceeded || !b.over() {
+		return false
+	}
+	b.exceeded = true
+	return true
+}
+
+// budget rejects queries run with a context whose strict budget is used up,
+// reporting them through the callbacks.
+func (o *Options) budget(ctx context.Context, original string, query string, args []any) error {
+	for b, _ := BudgetFromContext(ctx); b != nil; b = b.parent {
+		first, err := b.reject(query)
+		if err == nil {
+			continue
+		}
+		if first {
+			o.budgetExceeded(ctx, b)
+		}
+		o.report(ctx, Event{Query: query, OriginalQuery: original, Args: args, Err: err})
+		return err
+	}
+	return nil
+}
+
+// spendBudget counts a query towards the budgets of its context.
+func (o *Options) spendBudget(ctx context.Context, ev Event) {
+	b, ok := BudgetFromContext(ctx)
+	if !ok {
+		return
+	}
+	for ; b != nil; b = b.parent {
+		if b.spend(ev) {
+			o.budgetExceeded(ctx, b)
+		}
+	}
+}
+
+func (o *Options) budgetExceeded(ctx context.Context, b *Budget) {
+	if o.OnBudgetExceeded != nil {
+		o.OnBudgetExceeded(ctx, b.Summary())
+	}
+}
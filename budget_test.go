@@ -0,0 +1,65 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudget(t *testing.T) {
+	var exceeded []BudgetSummary
+	driverName, err := Register("sqlite3", Options{
+		OnBudgetExceeded: func(_ context.Context, summary BudgetSummary) { exceeded = append(exceeded, summary) },
+	})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+
+	ctx := WithBudget(ctx, 2, 0)
+	for i := 0; i < 3; i++ {
+		_, err = db.ExecContext(ctx, "select $1", i)
+		assert.NoError(t, err)
+	}
+
+	b, ok := BudgetFromContext(ctx)
+	if !assert.True(t, ok) {
+		return
+	}
+	summary := b.Summary()
+	assert.Equal(t, 3, summary.Queries)
+	assert.True(t, summary.Exceeded)
+	assert.Equal(t, "select $1", summary.Slowest)
+	assert.GreaterOrEqual(t, summary.DBTime, summary.SlowestDuration)
+	assert.Len(t, exceeded, 1)
+	assert.Equal(t, 3, exceeded[0].Queries)
+	assert.Equal(t, map[string]int{"select ?": 3}, summary.Fingerprints)
+}
+
+func TestStrictBudget(t *testing.T) {
+	var events []Event
+	driverName, err := Register("sqlite3", Options{OnEvent: func(_ context.Context, ev Event) { events = append(events, ev) }})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+
+	outer := WithBudget(ctx, 0, 0)
+	inner := WithStrictBudget(outer, 1, 0)
+	_, err = db.ExecContext(inner, "select 1")
+	assert.NoError(t, err)
+	_, err = db.ExecContext(inner, "select 2")
+	var budgetErr *BudgetError
+	assert.True(t, errors.As(err, &budgetErr))
+	assert.Equal(t, 1, budgetErr.Queries)
+	assert.Equal(t, CategoryRejected, events[len(events)-1].ErrorClass.Category)
+
+	b, _ := BudgetFromContext(inner)
+	assert.Equal(t, 1, b.Summary().Queries)
+	assert.Equal(t, 1, b.Summary().Rejected)
+
+	b, _ = BudgetFromContext(outer)
+	assert.Equal(t, 1, b.Summary().Queries)
+	assert.False(t, b.Summary().Exceeded)
+}
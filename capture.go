@@ -0,0 +1,195 @@
+package querypulse
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Capture records how often each test of a suite runs each Fingerprint and
+// how long it takes, so two runs can be compared with `querypulse diff`, such
+// as before and after upgrading an ORM. Set it on Options.Capture and call
+// Test at the start of each test.
+//
+// Queries are attributed to the test in progress. While tests run in
+// parallel, queries can't be told apart and are recorded under the test ""
+// unless they are run with a context from WithCaptureTest.
+//
+//	var capture = querypulse.NewCapture()
+//
+//	func TestMain(m *testing.M) {
+//		driverName, _ = querypulse.Register("postgres", querypulse.Options{Capture: capture})
+//		code := m.Run()
+//		if path := os.Getenv("QUERYPULSE_CAPTURE"); path != "" {
+//			capture.WriteFile(path)
+//		}
+//		os.Exit(code)
+//	}
+type Capture struct {
+	mu sync.Mutex
+	// running are the names of the tests in progress, in the order they started.
+	running      []string
+	tests        map[string]map[string]*captureStats
+	fingerprints map[string]*captureStats
+}
+
+type captureStats struct {
+	errors  int64
+	latency histogram
+}
+
+// CaptureT is the part of testing.TB used by Capture.Test.
+type CaptureT interface {
+	Name() string
+	Cleanup(func())
+}
+
+// NewCapture returns an empty Capture.
+func NewCapture() *Capture {
+	return &Capture{}
+}
+
+// CaptureSnapshot is a copy of what a Capture recorded. Queries run outside
+// of a test are recorded under the test "".
+type CaptureSnapshot struct {
+	// Tests are the statistics of each test, keyed by test then fingerprint.
+	Tests map[string]map[string]CaptureStats `json:"tests"`
+	// Fingerprints are the statistics of each fingerprint over all the tests.
+	Fingerprints map[string]CaptureStats `json:"fingerprints"`
+}
+
+// CaptureStats are the statistics for one Fingerprint. Percentiles are
+// approximate, like FingerprintStats.
+type CaptureStats struct {
+	Count       int64   `json:"count"`
+	Errors      int64   `json:"errors"`
+	TotalTimeMs float64 `json:"total_time_ms"`
+	MeanMs      float64 `json:"mean_ms"`
+	P50Ms       float64 `json:"p50_ms"`
+	P95Ms       float64 `json:"p95_ms"`
+	MaxMs       float64 `json:"max_ms"`
+}
+
+type captureTestKey struct{}
+
+// WithCaptureTest attributes the queries run with the context to the test
+// name. Use it for tests that run in parallel, whose queries Capture.Test
+// can't attribute.
+func WithCaptureTest(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, captureTestKey{}, name)
+}
+
+// Test attributes the queries run until t finishes to t.
+func (c *Capture) Test(t CaptureT) {
+	name := t.Name()
+	c.mu.Lock()
+	c.running = append(c.running, name)
+	c.mu.Unlock()
+	t.Cleanup(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i := len(c.running) - 1; i >= 0; i-- {
+			if c.running[i] == name {
+				c.running = append(c.running[:i], c.running[i+1:]...)
+				break
+			}
+		}
+	})
+}
+
+func (c *Capture) record(ctx context.Context, ev Event) {
+	if c == nil {
+		return
+	}
+	fingerprint := ev.Fingerprint
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	test, ok := ctx.Value(captureTestKey{}).(string)
+	if !ok {
+		test = c.current()
+	}
+	if c.tests == nil {
+		c.tests = map[string]map[string]*captureStats{}
+		c.fingerprints = map[string]*captureStats{}
+	}
+	if c.tests[test] == nil {
+		c.tests[test] = map[string]*captureStats{}
+	}
+	for _, stats := range []map[string]*captureStats{c.tests[test], c.fingerprints} {
+		s, ok := stats[fingerprint]
+		if !ok {
+			s = &captureStats{}
+			stats[fingerprint] = s
+		}
+		s.latency.add(ev.Duration)
+		if ev.Err != nil {
+			s.errors++
+		}
+	}
+}
+
+// current returns the test in progress, or "" if there is none or several
+// are running in parallel. Parents waiting for a subtest don't count.
+func (c *Capture) current() string {
+	if len(c.running) == 0 {
+		return ""
+	}
+	last := c.running[len(c.running)-1]
+	for _, name := range c.running[:len(c.running)-1] {
+		if !strings.HasPrefix(last, name+"/") {
+			return ""
+		}
+	}
+	return last
+}
+
+// Snapshot returns a copy of what has been recorded.
+func (c *Capture) Snapshot() CaptureSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snap := CaptureSnapshot{
+		Tests:        make(map[string]map[string]CaptureStats, len(c.tests)),
+		Fingerprints: make(map[string]CaptureStats, len(c.fingerprints)),
+	}
+	for test, fingerprints := range c.tests {
+		snap.Tests[test] = make(map[string]CaptureStats, len(fingerprints))
+		for fp, s := range fingerprints {
+			snap.Tests[test][fp] = s.snapshot()
+		}
+	}
+	for fp, s := range c.fingerprints {
+		snap.Fingerprints[fp] = s.snapshot()
+	}
+	return snap
+}
+
+func (s *captureStats) snapshot() CaptureStats {
+	return CaptureStats{
+		Count:       s.latency.count,
+		Errors:      s.errors,
+		TotalTimeMs: ms(s.latency.sum),
+		MeanMs:      ms(s.latency.mean()),
+		P50Ms:       ms(s.latency.quantile(0.50)),
+		P95Ms:       ms(s.latency.quantile(0.95)),
+		MaxMs:       ms(s.latency.max),
+	}
+}
+
+// WriteFile writes a snapshot as JSON to path, for `querypulse diff`.
+func (c *Capture) WriteFile(path string) error {
+	b, err := json.MarshalIndent(c.Snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// ReadCapture reads a snapshot written by Capture.WriteFile.
+func ReadCapture(r io.Reader) (CaptureSnapshot, error) {
+	var snap CaptureSnapshot
+	err := json.NewDecoder(r).Decode(&snap)
+	return snap, err
+}
@@ -0,0 +1,79 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	capture := NewCapture()
+	driverName, err := Register("sqlite3", Options{Capture: capture})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("select 1")
+	assert.NoError(t, err)
+
+	t.Run("users", func(t *testing.T) {
+		capture.Test(t)
+		for i := 0; i < 3; i++ {
+			_, err := db.Exec("select $1", i)
+			assert.NoError(t, err)
+		}
+		_, err := db.ExecContext(WithCaptureTest(context.Background(), "parallel"), "select $1", 1)
+		assert.NoError(t, err)
+		_, err = db.Exec("select * from missing")
+		assert.Error(t, err)
+	})
+
+	snap := capture.Snapshot()
+	assert.Equal(t, int64(1), snap.Tests[""]["select ?"].Count)
+	users := snap.Tests["TestCapture/users"]
+	assert.Equal(t, int64(3), users["select ?"].Count)
+	assert.Equal(t, int64(1), users["select * from missing"].Errors)
+	assert.Equal(t, int64(1), snap.Tests["parallel"]["select ?"].Count)
+	assert.Equal(t, int64(5), snap.Fingerprints["select ?"].Count)
+	assert.GreaterOrEqual(t, snap.Fingerprints["select ?"].MaxMs, snap.Fingerprints["select ?"].P50Ms)
+
+	path := filepath.Join(t.TempDir(), "capture.json")
+	assert.NoError(t, capture.WriteFile(path))
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	read, err := ReadCapture(f)
+	assert.NoError(t, err)
+	assert.Equal(t, snap, read)
+}
+
+type captureT struct {
+	name     string
+	cleanups []func()
+}
+
+func (t *captureT) Name() string      { return t.name }
+func (t *captureT) Cleanup(fn func()) { t.cleanups = append(t.cleanups, fn) }
+
+func TestCapture_parallel(t *testing.T) {
+	capture := NewCapture()
+	parent := &captureT{name: "TestUsers"}
+	capture.Test(parent)
+	a := &captureT{name: "TestUsers/a"}
+	capture.Test(a)
+	assert.Equal(t, "TestUsers/a", capture.current(), "parents waiting for a subtest don't count")
+
+	b := &captureT{name: "TestUsers/b"}
+	capture.Test(b)
+	assert.Equal(t, "", capture.current(), "parallel tests can't be told apart")
+
+	for _, fn := range a.cleanups {
+		fn()
+	}
+	assert.Equal(t, "TestUsers/b", capture.current())
+}
@@ -0,0 +1,201 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Category is a driver independent kind of database error.
+type Category string
+
+const (
+	CategoryUniqueViolation      Category = "unique_violation"
+	CategoryForeignKeyViolation  Category = "foreign_key_violation"
+	CategorySerializationFailure Category = "serialization_failure"
+	CategoryDeadlock             Category = "deadlock"
+	CategoryBusy                 Category = "busy" // lock contention that isn't a deadlock, such as SQLITE_BUSY
+	CategoryConnectionLost       Category = "connection_lost"
+	CategoryTimeout              Category = "timeout"
+	CategoryCancelled            Category = "cancelled"
+	CategorySyntax               Category = "syntax"
+	// CategoryRejected is for queries querypulse stopped itself, such as by a Guard or a strict budget.
+	CategoryRejected Category = "rejected"
+	CategoryOther    Category = "other"
+)
+
+// ErrorClass describes an error returned by a query.
+type ErrorClass struct {
+	Category Category
+	// Code is the driver specific code the Category came from, such as a
+	// Postgres SQLSTATE, SQLite extended result code or MySQL error number.
+	Code string
+	// Retryable is true when running the query again may succeed.
+	Retryable bool
+}
+
+// Labels returns the class as labels for metrics.
+func (c ErrorClass) Labels() map[string]string {
+	return map[string]string{
+		"category":  string(c.Category),
+		"retryable": strconv.FormatBool(c.Retryable),
+	}
+}
+
+// ClassifyError classifies errors from lib/pq, pgx, mattn/go-sqlite3 and
+// go-sql-driver/mysql as well as context and connection errors.
+// It returns the zero ErrorClass for a nil error.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClass{}
+	}
+
+	var guardErr *GuardError
+	var readOnlyErr *ReadOnlyError
+	var budgetErr *BudgetError
+	if errors.As(err, &guardErr) || errors.As(err, &readOnlyErr) || errors.As(err, &budgetErr) {
+		return ErrorClass{Category: CategoryRejected}
+	}
+
+	var sqlState interface{ SQLState() string }
+	if errors.As(err, &sqlState) {
+		return classifySQLState(sqlState.SQLState())
+	}
+	if code, ok := errorField(err, "github.com/mattn/go-sqlite3", "Error", "ExtendedCode"); ok {
+		return classifySQLite(code, err.Error())
+	}
+	if number, ok := errorField(err, "github.com/go-sql-driver/mysql", "MySQLError", "Number"); ok {
+		return classifyMySQL(number)
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClass{Category: CategoryTimeout}
+	case errors.Is(err, context.Canceled):
+		return ErrorClass{Category: CategoryCancelled}
+	case errors.Is(err, driver.ErrBadConn):
+		return ErrorClass{Category: CategoryConnectionLost, Retryable: true}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClass{Category: CategoryTimeout}
+		}
+		return ErrorClass{Category: CategoryConnectionLost}
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorClass{Category: CategoryConnectionLost}
+	}
+	return ErrorClass{Category: CategoryOther}
+}
+
+func (o *Options) classify(err error) ErrorClass {
+	if o.ClassifyError != nil {
+		return o.ClassifyError(err)
+	}
+	return ClassifyError(err)
+}
+
+// classifySQLState classifies Postgres SQLSTATE codes.
+func classifySQLState(code string) ErrorClass {
+	class := ErrorClass{Category: CategoryOther, Code: code}
+	switch {
+	case code == "23505":
+		class.Category = CategoryUniqueViolation
+	case code == "23503":
+		class.Category = CategoryForeignKeyViolation
+	case code == "40001":
+		class.Category, class.Retryable = CategorySerializationFailure, true
+	case code == "40P01":
+		class.Category, class.Retryable = CategoryDeadlock, true
+	case code == "55P03":
+		class.Category, class.Retryable = CategoryTimeout, true
+	case code == "57014":
+		class.Category = CategoryCancelled
+	case code == "57P01" || code == "57P02" || code == "57P03" || code == "53300":
+		class.Category, class.Retryable = CategoryConnectionLost, true
+	case strings.HasPrefix(code, "08"):
+		class.Category, class.Retryable = CategoryConnectionLost, true
+	case code == "42601" || code == "42P01" || code == "42703" || code == "42883":
+		class.Category = CategorySyntax
+	}
+	return class
+}
+
+// classifySQLite classifies SQLite extended result codes.
+func classifySQLite(code int64, msg string) ErrorClass {
+	class := ErrorClass{Category: CategoryOther, Code: strconv.FormatInt(code, 10)}
+	switch code {
+	case 2067, 1555: // SQLITE_CONSTRAINT_UNIQUE, SQLITE_CONSTRAINT_PRIMARYKEY
+		class.Category = CategoryUniqueViolation
+	case 787: // SQLITE_CONSTRAINT_FOREIGNKEY
+		class.Category = CategoryForeignKeyViolation
+	case 9: // SQLITE_INTERRUPT
+		class.Category = CategoryCancelled
+	default:
+		switch code & 0xff {
+		case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+			class.Category, class.Retryable = CategoryBusy, true
+		case 1: // SQLITE_ERROR
+			if strings.Contains(msg, "syntax error") || strings.Contains(msg, "no such") {
+				class.Category = CategorySyntax
+			}
+		}
+	}
+	return class
+}
+
+// classifyMySQL classifies MySQL server error numbers.
+func classifyMySQL(number int64) ErrorClass {
+	class := ErrorClass{Category: CategoryOther, Code: strconv.FormatInt(number, 10)}
+	switch number {
+	case 1062, 1586:
+		class.Category = CategoryUniqueViolation
+	case 1216, 1217, 1451, 1452:
+		class.Category = CategoryForeignKeyViolation
+	case 1213:
+		class.Category, class.Retryable = CategoryDeadlock, true
+	case 1205:
+		class.Category, class.Retryable = CategoryTimeout, true
+	case 3024:
+		class.Category = CategoryTimeout
+	case 1317:
+		class.Category = CategoryCancelled
+	case 1064, 1146, 1054:
+		class.Category = CategorySyntax
+	case 2006, 2013, 1053:
+		class.Category, class.Retryable = CategoryConnectionLost, true
+	}
+	return class
+}
+
+// errorField reads an integer field from the first error in err's chain that
+// is the named struct type. This reads driver errors without importing the drivers.
+func errorField(err error, pkg string, name string, field string) (int64, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				continue
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct || v.Type().PkgPath() != pkg || v.Type().Name() != name {
+			continue
+		}
+		f := v.FieldByName(field)
+		switch {
+		case f.CanInt():
+			return f.Int(), true
+		case f.CanUint():
+			return int64(f.Uint()), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
@@ -0,0 +1,74 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected ErrorClass
+	}{
+		{name: "nil", err: nil, expected: ErrorClass{}},
+		{name: "pq unique", err: &pq.Error{Code: "23505"}, expected: ErrorClass{Category: CategoryUniqueViolation, Code: "23505"}},
+		{name: "pq serialization", err: &pq.Error{Code: "40001"}, expected: ErrorClass{Category: CategorySerializationFailure, Code: "40001", Retryable: true}},
+		{name: "pq deadlock wrapped", err: fmt.Errorf("saving: %w", &pq.Error{Code: "40P01"}), expected: ErrorClass{Category: CategoryDeadlock, Code: "40P01", Retryable: true}},
+		{name: "pq connection", err: &pq.Error{Code: "08006"}, expected: ErrorClass{Category: CategoryConnectionLost, Code: "08006", Retryable: true}},
+		{name: "pq syntax", err: &pq.Error{Code: "42601"}, expected: ErrorClass{Category: CategorySyntax, Code: "42601"}},
+		{name: "deadline", err: context.DeadlineExceeded, expected: ErrorClass{Category: CategoryTimeout}},
+		{name: "cancelled", err: context.Canceled, expected: ErrorClass{Category: CategoryCancelled}},
+		{name: "bad conn", err: driver.ErrBadConn, expected: ErrorClass{Category: CategoryConnectionLost, Retryable: true}},
+		{name: "guard", err: &GuardError{Rule: RuleDDL}, expected: ErrorClass{Category: CategoryRejected}},
+		{name: "other", err: fmt.Errorf("oops"), expected: ErrorClass{Category: CategoryOther}},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, ClassifyError(v.err))
+		})
+	}
+}
+
+func TestClassifyError_codes(t *testing.T) {
+	assert.Equal(t, ErrorClass{Category: CategoryBusy, Code: "5", Retryable: true}, classifySQLite(5, "database is locked"))
+	assert.Equal(t, ErrorClass{Category: CategoryBusy, Code: "262", Retryable: true}, classifySQLite(262, "database table is locked"))
+	assert.Equal(t, ErrorClass{Category: CategoryUniqueViolation, Code: "1062"}, classifyMySQL(1062))
+	assert.Equal(t, ErrorClass{Category: CategoryDeadlock, Code: "1213", Retryable: true}, classifyMySQL(1213))
+	assert.Equal(t, ErrorClass{Category: CategoryConnectionLost, Code: "2006", Retryable: true}, classifyMySQL(2006))
+	assert.Equal(t, ErrorClass{Category: CategoryOther, Code: "9999"}, classifyMySQL(9999))
+}
+
+func TestClassifyError_sqlite(t *testing.T) {
+	var events []Event
+	driverName, err := Register("sqlite3", Options{
+		OnEvent: func(ctx context.Context, event Event) { events = append(events, event) },
+	})
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("create table classified (id int primary key)")
+	assert.NoError(t, err)
+	defer db.Exec("drop table classified")
+
+	_, err = db.Exec("insert into classified values (1)")
+	assert.NoError(t, err)
+	_, err = db.Exec("insert into classified values (1)")
+	assert.Error(t, err)
+	assert.Equal(t, ErrorClass{Category: CategoryUniqueViolation, Code: "1555"}, events[2].ErrorClass)
+
+	_, err = db.Exec("not a valid statement")
+	assert.Error(t, err)
+	assert.Equal(t, CategorySyntax, events[3].ErrorClass.Category)
+	assert.Equal(t, map[string]string{"category": "syntax", "retryable": "false"}, events[3].ErrorClass.Labels())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/stephennancekivell/querypulse/qsbinlog"
+)
+
+func convertCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	rotated := fs.Bool("rotated", false, "also convert the logs rotated from each file, oldest first")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	h := slog.NewJSONHandler(stdout, nil)
+	convert := func(r io.Reader) error {
+		return readBinaryLog(r, func(rec qsbinlog.Record) error {
+			return h.Handle(context.Background(), logRecord(rec))
+		})
+	}
+	if fs.NArg() == 0 {
+		return convert(stdin)
+	}
+	for _, name := range fs.Args() {
+		names := []string{name}
+		if *rotated {
+			var err error
+			if names, err = qsbinlog.Files(name); err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			if err := convertFile(name, convert); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func convertFile(name string, convert func(io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := convert(f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// readBinaryLog calls fn with each event in a qsbinlog log. A log cut short,
+// such as by a crash, isn't an error.
+func readBinaryLog(r io.Reader, fn func(qsbinlog.Record) error) error {
+	reader, err := qsbinlog.NewReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// logRecord turns an event into a record like the ones qslog writes, so the
+// JSON can be read by report and other tools.
+func logRecord(rec qsbinlog.Record) slog.Record {
+	level, msg := slog.LevelInfo, "query success"
+	if rec.Error != "" {
+		level, msg = slog.LevelError, "query error"
+	}
+	r := slog.NewRecord(rec.Time, level, msg, 0)
+	r.AddAttrs(slog.String("query", rec.Query))
+	if rec.Args != nil {
+		r.AddAttrs(slog.Any("args", rec.Args))
+	}
+	r.AddAttrs(
+		slog.Float64("took_ms", float64(rec.Duration)/float64(time.Millisecond)),
+		slog.String("fingerprint", rec.Fingerprint),
+		slog.String("operation", string(rec.Operation)),
+		slog.Uint64("conn_id", rec.ConnID),
+	)
+	if rec.TxID != 0 {
+		r.AddAttrs(slog.Uint64("tx_id", rec.TxID))
+	}
+	if rec.Attempt > 1 {
+		r.AddAttrs(slog.Int("attempt", rec.Attempt))
+	}
+	if rec.Error != "" {
+		r.AddAttrs(slog.String("error", rec.Error), slog.String("error_category", string(rec.ErrorCategory)))
+	}
+	return r
+}
+
+// sniffBinaryLog reports whether r holds a qsbinlog log without consuming it.
+func sniffBinaryLog(r io.Reader) (*bufio.Reader, bool) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(8)
+	return br, qsbinlog.IsBinaryLog(head)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+	"github.com/stephennancekivell/querypulse/qsbinlog"
+)
+
+func binaryLog(t *testing.T) []byte {
+	var buf bytes.Buffer
+	enc := qsbinlog.NewEncoder(&buf, false)
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []querypulse.Event{
+		{Query: "select * from users where id = $1", Args: []any{int64(1)}, Duration: 1500 * time.Microsecond, Operation: querypulse.OpQuery, ConnID: 1},
+		{Query: "select * from users where id = $1", Args: []any{int64(2)}, Duration: 3500 * time.Microsecond, Operation: querypulse.OpQuery, ConnID: 1},
+		{Query: "insert into t values ($1)", Args: []any{"x"}, Duration: 300 * time.Microsecond, Operation: querypulse.OpExec, ConnID: 2, TxID: 3,
+			Err: errors.New("duplicate key"), ErrorClass: querypulse.ErrorClass{Category: querypulse.CategoryUniqueViolation}},
+	}
+	for i, ev := range events {
+		assert.NoError(t, enc.Encode(at.Add(time.Duration(i)*time.Second), ev))
+	}
+	return buf.Bytes()
+}
+
+func TestConvert(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"convert"}, bytes.NewReader(binaryLog(t)), &out))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+	var first, last map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &last))
+	assert.Equal(t, map[string]any{
+		"time": "2024-01-01T00:00:00Z", "level": "INFO", "msg": "query success",
+		"query": "select * from users where id = $1", "args": []any{1.0}, "took_ms": 1.5,
+		"fingerprint": "select * from users where id = ?", "operation": "query", "conn_id": 1.0,
+	}, first)
+	assert.Equal(t, "ERROR", last["level"])
+	assert.Equal(t, "duplicate key", last["error"])
+	assert.Equal(t, "unique_violation", last["error_category"])
+	assert.Equal(t, 3.0, last["tx_id"])
+
+	// the converted JSON can be reported on
+	var report bytes.Buffer
+	assert.NoError(t, run([]string{"report", "-format", "json"}, &out, &report))
+	assert.Contains(t, report.String(), `"queries": 3`)
+}
+
+func TestConvert_notBinary(t *testing.T) {
+	err := run([]string{"convert"}, strings.NewReader(testLogs), &bytes.Buffer{})
+	assert.Equal(t, qsbinlog.ErrFormat, err)
+}
+
+func TestReport_binary(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"report", "-format", "json"}, bytes.NewReader(binaryLog(t)), &out))
+
+	var report Report
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 3, report.Queries)
+	assert.Equal(t, 1, report.Errors)
+	assert.InDelta(t, 5.3, report.TotalTimeMs, 0.001)
+	assert.Equal(t, "select * from users where id = ?", report.ByCount[0].Fingerprint)
+	assert.Equal(t, "2024-01-01T00:00:01Z", report.Slowest[0].Time)
+}
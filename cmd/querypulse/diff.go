@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+// Diff compares two captures written by querypulse.Capture.
+type Diff struct {
+	NewFingerprints     []FingerprintChange `json:"new_fingerprints"`
+	RemovedFingerprints []FingerprintChange `json:"removed_fingerprints"`
+	NewTests            []string            `json:"new_tests"`
+	RemovedTests        []string            `json:"removed_tests"`
+	CountChanges        []CountChange       `json:"count_changes"`
+	LatencyRegressions  []LatencyChange     `json:"latency_regressions"`
+	// Failures are the kinds of change that fail the comparison, from -fail.
+	Failures []string `json:"failures,omitempty"`
+}
+
+// FingerprintChange is a fingerprint run in only one of the captures.
+type FingerprintChange struct {
+	Fingerprint string `json:"fingerprint"`
+	Count       int64  `json:"count"`
+}
+
+// CountChange is a test running a fingerprint a different number of times.
+type CountChange struct {
+	Test        string `json:"test"`
+	Fingerprint string `json:"fingerprint"`
+	Before      int64  `json:"before"`
+	After       int64  `json:"after"`
+}
+
+// LatencyChange is a fingerprint that got slower.
+type LatencyChange struct {
+	Fingerprint string  `json:"fingerprint"`
+	BeforeMs    float64 `json:"before_ms"`
+	AfterMs     float64 `json:"after_ms"`
+	// Change is the relative change, 0.5 being 50% slower.
+	Change float64 `json:"change"`
+}
+
+type diffOptions struct {
+	metric    string
+	threshold float64
+	minMs     float64
+}
+
+var diffMetrics = map[string]func(querypulse.CaptureStats) float64{
+	"p50":  func(s querypulse.CaptureStats) float64 { return s.P50Ms },
+	"p95":  func(s querypulse.CaptureStats) float64 { return s.P95Ms },
+	"mean": func(s querypulse.CaptureStats) float64 { return s.MeanMs },
+	"max":  func(s querypulse.CaptureStats) float64 { return s.MaxMs },
+}
+
+var diffFailures = []string{"new", "removed", "count", "latency"}
+
+func diffCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := fs.String("format", "text", "output format: text, json or markdown")
+	opts := diffOptions{}
+	fs.StringVar(&opts.metric, "metric", "p95", "latency to compare: p50, p95, mean or max")
+	fs.Float64Var(&opts.threshold, "threshold", 0.2, "relative slowdown reported as a regression, 0.2 being 20%")
+	fs.Float64Var(&opts.minMs, "min-ms", 1, "ignore slowdowns of fewer milliseconds than this")
+	fail := fs.String("fail", "new,count,latency", "changes that fail the comparison: new, removed, count and latency, or none")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: querypulse diff [flags] before.json after.json")
+	}
+	if _, ok := diffMetrics[opts.metric]; !ok {
+		return fmt.Errorf("unknown metric %q", opts.metric)
+	}
+	failOn := map[string]bool{}
+	for _, kind := range strings.Split(*fail, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" || kind == "none" {
+			continue
+		}
+		if !slices.Contains(diffFailures, kind) {
+			return fmt.Errorf("unknown -fail %q", kind)
+		}
+		failOn[kind] = true
+	}
+
+	before, err := readCaptureFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := readCaptureFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diff := compareCaptures(before, after, opts)
+	for kind, n := range map[string]int{
+		"new":     len(diff.NewFingerprints),
+		"removed": len(diff.RemovedFingerprints),
+		"count":   len(diff.CountChanges),
+		"latency": len(diff.LatencyRegressions),
+	} {
+		if failOn[kind] && n > 0 {
+			diff.Failures = append(diff.Failures, kind)
+		}
+	}
+	sort.Slice(diff.Failures, func(i, j int) bool {
+		return slices.Index(diffFailures, diff.Failures[i]) < slices.Index(diffFailures, diff.Failures[j])
+	})
+
+	switch *format {
+	case "text":
+		err = writeDiffText(stdout, diff, opts)
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diff)
+	case "markdown", "md":
+		err = writeDiffMarkdown(stdout, diff, opts)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if len(diff.Failures) > 0 {
+		return fmt.Errorf("queries changed: %s", strings.Join(diff.Failures, ", "))
+	}
+	return nil
+}
+
+func readCaptureFile(name string) (querypulse.CaptureSnapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return querypulse.CaptureSnapshot{}, err
+	}
+	defer f.Close()
+	snap, err := querypulse.ReadCapture(f)
+	if err != nil {
+		return snap, fmt.Errorf("%s: %w", name, err)
+	}
+	return snap, nil
+}
+
+func compareCaptures(before, after querypulse.CaptureSnapshot, opts diffOptions) Diff {
+	diff := Diff{}
+	for fp, s := range after.Fingerprints {
+		if _, ok := before.Fingerprints[fp]; !ok {
+			diff.NewFingerprints = append(diff.NewFingerprints, FingerprintChange{Fingerprint: fp, Count: s.Count})
+		}
+	}
+	for fp, s := range before.Fingerprints {
+		if _, ok := after.Fingerprints[fp]; !ok {
+			diff.RemovedFingerprints = append(diff.RemovedFingerprints, FingerprintChange{Fingerprint: fp, Count: s.Count})
+		}
+	}
+	for _, changes := range [][]FingerprintChange{diff.NewFingerprints, diff.RemovedFingerprints} {
+		sort.Slice(changes, func(i, j int) bool {
+			if changes[i].Count != changes[j].Count {
+				return changes[i].Count > changes[j].Count
+			}
+			return changes[i].Fingerprint < changes[j].Fingerprint
+		})
+	}
+
+	// counts are only compared for tests in both captures
+	for test, afterTest := range after.Tests {
+		beforeTest, ok := before.Tests[test]
+		if !ok {
+			diff.NewTests = append(diff.NewTests, test)
+			continue
+		}
+		for fp, s := range afterTest {
+			if s.Count != beforeTest[fp].Count {
+				diff.CountChanges = append(diff.CountChanges, CountChange{Test: test, Fingerprint: fp, Before: beforeTest[fp].Count, After: s.Count})
+			}
+		}
+		for fp, s := range beforeTest {
+			if _, ok := afterTest[fp]; !ok {
+				diff.CountChanges = append(diff.CountChanges, CountChange{Test: test, Fingerprint: fp, Before: s.Count})
+			}
+		}
+	}
+	for test := range before.Tests {
+		if _, ok := after.Tests[test]; !ok {
+			diff.RemovedTests = append(diff.RemovedTests, test)
+		}
+	}
+	sort.Strings(diff.NewTests)
+	sort.Strings(diff.RemovedTests)
+	sort.Slice(diff.CountChanges, func(i, j int) bool {
+		a, b := diff.CountChanges[i], diff.CountChanges[j]
+		if a.Test != b.Test {
+			return a.Test < b.Test
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+
+	metric := diffMetrics[opts.metric]
+	for fp, s := range after.Fingerprints {
+		b, ok := before.Fingerprints[fp]
+		if !ok {
+			continue
+		}
+		beforeMs, afterMs := metric(b), metric(s)
+		if afterMs-beforeMs < opts.minMs || afterMs <= beforeMs*(1+opts.threshold) {
+			continue
+		}
+		change := LatencyChange{Fingerprint: fp, BeforeMs: beforeMs, AfterMs: afterMs}
+		if beforeMs > 0 {
+			change.Change = afterMs/beforeMs - 1
+		}
+		diff.LatencyRegressions = append(diff.LatencyRegressions, change)
+	}
+	sort.Slice(diff.LatencyRegressions, func(i, j int) bool {
+		a, b := diff.LatencyRegressions[i], diff.LatencyRegressions[j]
+		if a.AfterMs-a.BeforeMs != b.AfterMs-b.BeforeMs {
+			return a.AfterMs-a.BeforeMs > b.AfterMs-b.BeforeMs
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+	return diff
+}
+
+func writeDiffText(w io.Writer, d Diff, opts diffOptions) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d new fingerprints, %d removed, %d count changes, %d latency regressions\n",
+		len(d.NewFingerprints), len(d.RemovedFingerprints), len(d.CountChanges), len(d.LatencyRegressions))
+
+	for _, table := range []struct {
+		title   string
+		changes []FingerprintChange
+	}{{"New fingerprints", d.NewFingerprints}, {"Removed fingerprints", d.RemovedFingerprints}} {
+		if len(table.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%s\n", table.title)
+		fmt.Fprintln(tw, "COUNT\tFINGERPRINT")
+		for _, c := range table.changes {
+			fmt.Fprintf(tw, "%d\t%s\n", c.Count, truncate(c.Fingerprint))
+		}
+	}
+
+	if len(d.CountChanges) > 0 {
+		fmt.Fprintf(tw, "\nCount changes\n")
+		fmt.Fprintln(tw, "TEST\tBEFORE\tAFTER\tFINGERPRINT")
+		for _, c := range d.CountChanges {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", testName(c.Test), c.Before, c.After, truncate(c.Fingerprint))
+		}
+	}
+
+	if len(d.LatencyRegressions) > 0 {
+		fmt.Fprintf(tw, "\nLatency regressions (%s)\n", opts.metric)
+		fmt.Fprintln(tw, "BEFORE MS\tAFTER MS\tCHANGE\tFINGERPRINT")
+		for _, c := range d.LatencyRegressions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", formatMs(c.BeforeMs), formatMs(c.AfterMs), formatChange(c.Change), truncate(c.Fingerprint))
+		}
+	}
+
+	if len(d.NewTests) > 0 || len(d.RemovedTests) > 0 {
+		fmt.Fprintf(tw, "\n%d tests only in after: %s\n", len(d.NewTests), strings.Join(d.NewTests, ", "))
+		fmt.Fprintf(tw, "%d tests only in before: %s\n", len(d.RemovedTests), strings.Join(d.RemovedTests, ", "))
+	}
+	return tw.Flush()
+}
+
+func writeDiffMarkdown(w io.Writer, d Diff, opts diffOptions) error {
+	fmt.Fprintf(w, "# Query diff\n\n%d new fingerprints, %d removed, %d count changes, %d latency regressions\n",
+		len(d.NewFingerprints), len(d.RemovedFingerprints), len(d.CountChanges), len(d.LatencyRegressions))
+
+	for _, table := range []struct {
+		title   string
+		changes []FingerprintChange
+	}{{"New fingerprints", d.NewFingerprints}, {"Removed fingerprints", d.RemovedFingerprints}} {
+		if len(table.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n## %s\n\n", table.title)
+		fmt.Fprintln(w, "| Count | Fingerprint |")
+		fmt.Fprintln(w, "|---:|---|")
+		for _, c := range table.changes {
+			fmt.Fprintf(w, "| %d | %s |\n", c.Count, markdownCode(c.Fingerprint))
+		}
+	}
+
+	if len(d.CountChanges) > 0 {
+		fmt.Fprintf(w, "\n## Count changes\n\n")
+		fmt.Fprintln(w, "| Test | Before | After | Fingerprint |")
+		fmt.Fprintln(w, "|---|---:|---:|---|")
+		for _, c := range d.CountChanges {
+			fmt.Fprintf(w, "| %s | %d | %d | %s |\n", markdownText(testName(c.Test)), c.Before, c.After, markdownCode(c.Fingerprint))
+		}
+	}
+
+	if len(d.LatencyRegressions) > 0 {
+		fmt.Fprintf(w, "\n## Latency regressions (%s)\n\n", opts.metric)
+		fmt.Fprintln(w, "| Before ms | After ms | Change | Fingerprint |")
+		fmt.Fprintln(w, "|---:|---:|---:|---|")
+		for _, c := range d.LatencyRegressions {
+			fmt.Fprintf(w, "| %s | %s | %s | %s |\n", formatMs(c.BeforeMs), formatMs(c.AfterMs), formatChange(c.Change), markdownCode(c.Fingerprint))
+		}
+	}
+
+	if len(d.NewTests) > 0 || len(d.RemovedTests) > 0 {
+		_, err := fmt.Fprintf(w, "\n%d tests only in after, %d tests only in before.\n", len(d.NewTests), len(d.RemovedTests))
+		return err
+	}
+	return nil
+}
+
+// testName names the queries run outside of a test.
+func testName(test string) string {
+	if test == "" {
+		return "(no test)"
+	}
+	return test
+}
+
+func formatChange(change float64) string {
+	if change == 0 {
+		// it took no time before
+		return "-"
+	}
+	return fmt.Sprintf("+%.0f%%", 100*change)
+}
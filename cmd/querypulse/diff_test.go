@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+func writeCapture(t *testing.T, snap querypulse.CaptureSnapshot) string {
+	b, err := json.Marshal(snap)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "capture.json")
+	assert.NoError(t, os.WriteFile(path, b, 0o644))
+	return path
+}
+
+func testCaptures(t *testing.T) (string, string) {
+	before := writeCapture(t, querypulse.CaptureSnapshot{
+		Tests: map[string]map[string]querypulse.CaptureStats{
+			"TestUsers":  {"select * from users where id = ?": {Count: 1}, "select * from orgs": {Count: 1}},
+			"TestOrders": {"select * from orders": {Count: 2}},
+			"TestOld":    {"select * from orders": {Count: 1}},
+		},
+		Fingerprints: map[string]querypulse.CaptureStats{
+			"select * from users where id = ?": {Count: 1, P95Ms: 2},
+			"select * from orgs":               {Count: 1, P95Ms: 1},
+			"select * from orders":             {Count: 3, P95Ms: 10},
+		},
+	})
+	after := writeCapture(t, querypulse.CaptureSnapshot{
+		Tests: map[string]map[string]querypulse.CaptureStats{
+			"TestUsers":  {"select * from users where id = ?": {Count: 5}, "select * from orgs join users": {Count: 1}},
+			"TestOrders": {"select * from orders": {Count: 2}},
+			"TestNew":    {"select * from orders": {Count: 1}},
+		},
+		Fingerprints: map[string]querypulse.CaptureStats{
+			"select * from users where id = ?": {Count: 5, P95Ms: 2.5},
+			"select * from orgs join users":    {Count: 1, P95Ms: 1},
+			"select * from orders":             {Count: 3, P95Ms: 20},
+		},
+	})
+	return before, after
+}
+
+func TestDiff(t *testing.T) {
+	before, after := testCaptures(t)
+	var out bytes.Buffer
+	err := run([]string{"diff", "-format", "json", before, after}, nil, &out)
+	assert.EqualError(t, err, "queries changed: new, count, latency")
+
+	var diff Diff
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &diff))
+	assert.Equal(t, []FingerprintChange{{Fingerprint: "select * from orgs join users", Count: 1}}, diff.NewFingerprints)
+	assert.Equal(t, []FingerprintChange{{Fingerprint: "select * from orgs", Count: 1}}, diff.RemovedFingerprints)
+	assert.Equal(t, []string{"TestNew"}, diff.NewTests)
+	assert.Equal(t, []string{"TestOld"}, diff.RemovedTests)
+	assert.Equal(t, []CountChange{
+		{Test: "TestUsers", Fingerprint: "select * from orgs", Before: 1, After: 0},
+		{Test: "TestUsers", Fingerprint: "select * from orgs join users", Before: 0, After: 1},
+		{Test: "TestUsers", Fingerprint: "select * from users where id = ?", Before: 1, After: 5},
+	}, diff.CountChanges)
+	// users got 25% slower, but by less than -min-ms
+	assert.Equal(t, []LatencyChange{{Fingerprint: "select * from orders", BeforeMs: 10, AfterMs: 20, Change: 1}}, diff.LatencyRegressions)
+}
+
+func TestDiff_fail(t *testing.T) {
+	before, after := testCaptures(t)
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"diff", "-fail", "none", before, after}, nil, &out))
+	assert.Contains(t, out.String(), "1 new fingerprints, 1 removed, 3 count changes, 1 latency regressions")
+	assert.Contains(t, out.String(), "Latency regressions (p95)")
+	assert.Contains(t, out.String(), "+100%")
+
+	out.Reset()
+	assert.EqualError(t, run([]string{"diff", "-fail", "removed", "-format", "markdown", before, after}, nil, &out), "queries changed: removed")
+	assert.Contains(t, out.String(), "| TestUsers | 1 | 5 | `select * from users where id = ?` |")
+
+	assert.NoError(t, run([]string{"diff", before, before}, nil, &out))
+	assert.Error(t, run([]string{"diff", "-fail", "bogus", before, after}, nil, &out))
+	assert.Error(t, run([]string{"diff", before}, nil, &out))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// maxTextQuery truncates queries in the text output so the tables stay readable.
+const maxTextQuery = 100
+
+func writeText(w io.Writer, r Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d queries, %d errors, %s ms total\n", r.Queries, r.Errors, formatMs(r.TotalTimeMs))
+
+	for _, table := range fingerprintTables(r) {
+		fmt.Fprintf(tw, "\n%s\n", table.title)
+		fmt.Fprintln(tw, "COUNT\tERRORS\tTOTAL MS\tMEAN MS\tP50 MS\tP95 MS\tP99 MS\tMAX MS\tFINGERPRINT")
+		for _, s := range table.rows {
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Count, s.Errors, formatMs(s.TotalTimeMs),
+				formatMs(s.MeanMs), formatMs(s.P50Ms), formatMs(s.P95Ms), formatMs(s.P99Ms), formatMs(s.MaxMs), truncate(s.Fingerprint))
+		}
+	}
+
+	fmt.Fprintf(tw, "\nErrors\n")
+	fmt.Fprintln(tw, "COUNT\tFINGERPRINT\tERROR")
+	for _, e := range r.ErrorGroups {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", e.Count, truncate(e.Fingerprint), e.Error)
+	}
+
+	fmt.Fprintf(tw, "\nSlowest executions\n")
+	fmt.Fprintln(tw, "MS\tTIME\tQUERY\tARGS")
+	for _, e := range r.Slowest {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", formatMs(e.DurationMs), e.Time, truncate(e.Query), formatArgs(e.Args))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nLatency histogram\n")
+	max := 0
+	for _, b := range r.Histogram {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+	for _, b := range r.Histogram {
+		bar := 0
+		if max > 0 {
+			bar = b.Count * 40 / max
+		}
+		_, err := fmt.Fprintf(w, "%10s %8d %s\n", bucketLabel(b), b.Count, strings.Repeat("#", bar))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMarkdown(w io.Writer, r Report) error {
+	fmt.Fprintf(w, "# Query report\n\n%d queries, %d errors, %s ms total\n", r.Queries, r.Errors, formatMs(r.TotalTimeMs))
+
+	for _, table := range fingerprintTables(r) {
+		fmt.Fprintf(w, "\n## %s\n\n", table.title)
+		fmt.Fprintln(w, "| Count | Errors | Total ms | Mean ms | p50 ms | p95 ms | p99 ms | Max ms | Fingerprint |")
+		fmt.Fprintln(w, "|---:|---:|---:|---:|---:|---:|---:|---:|---|")
+		for _, s := range table.rows {
+			fmt.Fprintf(w, "| %d | %d | %s | %s | %s | %s | %s | %s | %s |\n", s.Count, s.Errors, formatMs(s.TotalTimeMs),
+				formatMs(s.MeanMs), formatMs(s.P50Ms), formatMs(s.P95Ms), formatMs(s.P99Ms), formatMs(s.MaxMs), markdownCode(s.Fingerprint))
+		}
+	}
+
+	fmt.Fprintf(w, "\n## Errors\n\n")
+	fmt.Fprintln(w, "| Count | Fingerprint | Error |")
+	fmt.Fprintln(w, "|---:|---|---|")
+	for _, e := range r.ErrorGroups {
+		fmt.Fprintf(w, "| %d | %s | %s |\n", e.Count, markdownCode(e.Fingerprint), markdownText(e.Error))
+	}
+
+	fmt.Fprintf(w, "\n## Slowest executions\n\n")
+	fmt.Fprintln(w, "| ms | Time | Query | Args |")
+	fmt.Fprintln(w, "|---:|---|---|---|")
+	for _, e := range r.Slowest {
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", formatMs(e.DurationMs), e.Time, markdownCode(e.Query), markdownCode(formatArgs(e.Args)))
+	}
+
+	fmt.Fprintf(w, "\n## Latency histogram\n\n")
+	fmt.Fprintln(w, "| Latency | Count |")
+	fmt.Fprintln(w, "|---|---:|")
+	for _, b := range r.Histogram {
+		if _, err := fmt.Fprintf(w, "| %s | %d |\n", bucketLabel(b), b.Count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type fingerprintTable struct {
+	title string
+	rows  []FingerprintSummary
+}
+
+func fingerprintTables(r Report) []fingerprintTable {
+	return []fingerprintTable{
+		{"Top by total time", r.ByTotalTime},
+		{"Top by count", r.ByCount},
+		{"Top by p99", r.ByP99},
+	}
+}
+
+func bucketLabel(b Bucket) string {
+	if b.UpToMs == 0 {
+		return "> " + strconv.FormatFloat(bucketLimits[len(bucketLimits)-1], 'f', -1, 64) + " ms"
+	}
+	return "<= " + strconv.FormatFloat(b.UpToMs, 'f', -1, 64) + " ms"
+}
+
+func truncate(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= maxTextQuery {
+		return s
+	}
+	end := maxTextQuery
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end] + "..."
+}
+
+func formatArgs(args []any) string {
+	if len(args) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Sprint(args)
+	}
+	return string(b)
+}
+
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ReplaceAll(s, "`", "'")
+	return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+}
+
+func markdownText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.ReplaceAll(s, "|", `\|`)
+}
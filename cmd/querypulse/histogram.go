@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// histogram approximates a latency distribution with exponential buckets,
+// four per doubling, from 1µs to about an hour, like querypulse.Stats does.
+type histogram struct {
+	buckets [128]int64
+	count   int64
+	sum     time.Duration
+	max     time.Duration
+}
+
+const histogramBase = time.Microsecond
+
+func (h *histogram) add(d time.Duration) {
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+	i := 0
+	if d > histogramBase {
+		i = int(math.Ceil(4 * math.Log2(float64(d)/float64(histogramBase))))
+	}
+	if i >= len(h.buckets) {
+		i = len(h.buckets) - 1
+	}
+	h.buckets[i]++
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// quantile returns the upper bound of the bucket holding the q quantile, capped at max.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.count)))
+	var seen int64
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			upper := time.Duration(float64(histogramBase) * math.Pow(2, float64(i)/4))
+			if upper > h.max {
+				return h.max
+			}
+			return upper
+		}
+	}
+	return h.max
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
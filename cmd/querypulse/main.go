@@ -0,0 +1,71 @@
+// Command querypulse analyzes the queries logged by querypulse.
+//
+// Usage:
+//
+//	querypulse report [flags] [file ...]
+//	querypulse top [flags]
+//	querypulse convert [flags] [file ...]
+//	querypulse diff [flags] before.json after.json
+//
+// report reads JSON logs written by qslog, or binary logs written by
+// qsbinlog, from the files, or from stdin when there are none, and prints the fingerprints that took the most time, ran the
+// most and had the worst p99, the errors, the slowest executions and a latency
+// histogram.
+//
+// top polls the statistics served by querypulse.Stats, or published with
+// Stats.PublishExpvar, and shows a table of fingerprints that refreshes like
+// top, with the queries in flight highlighted.
+//
+// convert turns binary logs written by qsbinlog into JSON lines like the ones
+// qslog writes.
+//
+// diff compares two captures written by querypulse.Capture, such as from
+// runs of a test suite before and after upgrading an ORM. It lists the
+// fingerprints that are new or gone, the tests that run a fingerprint a
+// different number of times and the fingerprints that got slower, and exits
+// with an error when the changes named by -fail are found, to fail CI.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: querypulse <command> [flags] [args]
+
+commands:
+  report   summarize queries from qslog JSON logs or qsbinlog binary logs
+  top      show live query statistics from a service's debug endpoint
+  convert  convert qsbinlog binary logs to JSON lines
+  diff     compare the queries of two runs captured with querypulse.Capture
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "querypulse:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("no command")
+	}
+	switch args[0] {
+	case "report":
+		return reportCommand(args[1:], stdin, stdout)
+	case "top":
+		return topCommand(args[1:], stdout)
+	case "convert":
+		return convertCommand(args[1:], stdin, stdout)
+	case "diff":
+		return diffCommand(args[1:], stdout)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", args[0])
+}
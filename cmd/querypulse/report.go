@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/stephennancekivell/querypulse"
+	"github.com/stephennancekivell/querypulse/qsbinlog"
+)
+
+// keys names the attributes of a log record, matching qslog.Keys.
+type keys struct {
+	query, args, duration, err, time string
+	// unit is what the duration is logged in.
+	unit time.Duration
+}
+
+// execution is one query read from the logs.
+type execution struct {
+	Time       string  `json:"time,omitempty"`
+	Query      string  `json:"query"`
+	Args       []any   `json:"args,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Report is the summary printed by the report command.
+type Report struct {
+	Queries     int                  `json:"queries"`
+	Errors      int                  `json:"errors"`
+	TotalTimeMs float64              `json:"total_time_ms"`
+	ByTotalTime []FingerprintSummary `json:"by_total_time"`
+	ByCount     []FingerprintSummary `json:"by_count"`
+	ByP99       []FingerprintSummary `json:"by_p99"`
+	ErrorGroups []ErrorSummary       `json:"error_groups"`
+	Slowest     []execution          `json:"slowest"`
+	Histogram   []Bucket             `json:"histogram"`
+}
+
+// FingerprintSummary is the latency of one fingerprint.
+type FingerprintSummary struct {
+	Fingerprint string  `json:"fingerprint"`
+	Count       int     `json:"count"`
+	Errors      int     `json:"errors"`
+	TotalTimeMs float64 `json:"total_time_ms"`
+	MeanMs      float64 `json:"mean_ms"`
+	P50Ms       float64 `json:"p50_ms"`
+	P95Ms       float64 `json:"p95_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+	MaxMs       float64 `json:"max_ms"`
+}
+
+// ErrorSummary counts one error message for one fingerprint.
+type ErrorSummary struct {
+	Fingerprint string `json:"fingerprint"`
+	Error       string `json:"error"`
+	Count       int    `json:"count"`
+}
+
+// Bucket counts the queries that took up to UpToMs. The last bucket has no limit.
+type Bucket struct {
+	UpToMs float64 `json:"up_to_ms,omitempty"`
+	Count  int     `json:"count"`
+}
+
+var bucketLimits = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000}
+
+func reportCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := fs.String("format", "text", "output format: text, json or markdown")
+	top := fs.Int("n", 10, "number of rows in each table")
+	k := keys{}
+	fs.StringVar(&k.query, "key-query", "query", "attribute holding the query")
+	fs.StringVar(&k.args, "key-args", "args", "attribute holding the args")
+	fs.StringVar(&k.duration, "key-duration", "took_ms", "attribute holding the duration")
+	fs.StringVar(&k.err, "key-error", "error", "attribute holding the error")
+	fs.StringVar(&k.time, "key-time", "time", "attribute holding the time")
+	fs.DurationVar(&k.unit, "duration-unit", time.Millisecond, "unit of the duration attribute")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *top < 1 {
+		return fmt.Errorf("-n must be at least 1, got %d", *top)
+	}
+
+	builder := newReportBuilder(*top)
+	read := func(r io.Reader) error {
+		r, binary := sniffBinaryLog(r)
+		if binary {
+			return readBinaryLog(r, func(rec qsbinlog.Record) error {
+				builder.add(execution{
+					Time:       rec.Time.Format(time.RFC3339Nano),
+					Query:      rec.Query,
+					Args:       rec.Args,
+					DurationMs: float64(rec.Duration) / float64(time.Millisecond),
+					Error:      rec.Error,
+				})
+				return nil
+			})
+		}
+		return readLogs(r, k, builder.add)
+	}
+	if fs.NArg() == 0 {
+		if err := read(stdin); err != nil {
+			return err
+		}
+	}
+	for _, name := range fs.Args() {
+		if name == "-" {
+			if err := read(stdin); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = read(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	report := builder.build()
+	switch *format {
+	case "text":
+		return writeText(stdout, report)
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "markdown", "md":
+		return writeMarkdown(stdout, report)
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+// readLogs reads JSON log records, one per line, calling fn with each query.
+// Lines that aren't JSON or don't have a query are skipped. Attributes grouped
+// by qslog.Options.Group are found too.
+func readLogs(r io.Reader, k keys, fn func(e execution)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		attrs := findAttrs(record, k.query)
+		if attrs == nil {
+			continue
+		}
+		e := execution{}
+		e.Query, _ = attrs[k.query].(string)
+		e.Args, _ = attrs[k.args].([]any)
+		e.Error, _ = attrs[k.err].(string)
+		e.Time, _ = record[k.time].(string)
+		d, _ := attrs[k.duration].(float64)
+		e.DurationMs = d * float64(k.unit) / float64(time.Millisecond)
+		fn(e)
+	}
+	return scanner.Err()
+}
+
+// findAttrs returns the record or the group within it that holds the query.
+func findAttrs(record map[string]any, queryKey string) map[string]any {
+	if _, ok := record[queryKey].(string); ok {
+		return record
+	}
+	for _, v := range record {
+		if group, ok := v.(map[string]any); ok {
+			if attrs := findAttrs(group, queryKey); attrs != nil {
+				return attrs
+			}
+		}
+	}
+	return nil
+}
+
+// reportBuilder builds a Report from executions as they are read, keeping
+// only what the report needs so logs of any size can be read.
+type reportBuilder struct {
+	report       Report
+	top          int
+	fingerprints map[string]*fingerprintStats
+	errorCounts  map[ErrorSummary]int
+	slowest      slowestHeap
+	seen         int
+}
+
+func newReportBuilder(top int) *reportBuilder {
+	b := &reportBuilder{
+		top:          top,
+		fingerprints: map[string]*fingerprintStats{},
+		errorCounts:  map[ErrorSummary]int{},
+	}
+	b.report.Histogram = make([]Bucket, len(bucketLimits)+1)
+	for i, limit := range bucketLimits {
+		b.report.Histogram[i].UpToMs = limit
+	}
+	return b
+}
+
+func (b *reportBuilder) add(e execution) {
+	b.report.Queries++
+	fingerprint := querypulse.Fingerprint(e.Query)
+	f, ok := b.fingerprints[fingerprint]
+	if !ok {
+		f = &fingerprintStats{}
+		b.fingerprints[fingerprint] = f
+	}
+	f.latency.add(time.Duration(e.DurationMs * float64(time.Millisecond)))
+	b.report.TotalTimeMs += e.DurationMs
+	if e.Error != "" {
+		f.errors++
+		b.report.Errors++
+		b.errorCounts[ErrorSummary{Fingerprint: fingerprint, Error: e.Error}]++
+	}
+	b.report.Histogram[sort.SearchFloat64s(bucketLimits, e.DurationMs)].Count++
+
+	b.seen++
+	heap.Push(&b.slowest, slowExecution{execution: e, order: b.seen})
+	if b.slowest.Len() > b.top {
+		heap.Pop(&b.slowest)
+	}
+}
+
+func (b *reportBuilder) build() Report {
+	report := b.report
+	summaries := make([]FingerprintSummary, 0, len(b.fingerprints))
+	for fingerprint, f := range b.fingerprints {
+		summaries = append(summaries, f.summary(fingerprint))
+	}
+	report.ByTotalTime = topBy(summaries, b.top, func(s FingerprintSummary) float64 { return s.TotalTimeMs })
+	report.ByCount = topBy(summaries, b.top, func(s FingerprintSummary) float64 { return float64(s.Count) })
+	report.ByP99 = topBy(summaries, b.top, func(s FingerprintSummary) float64 { return s.P99Ms })
+
+	for e, n := range b.errorCounts {
+		e.Count = n
+		report.ErrorGroups = append(report.ErrorGroups, e)
+	}
+	sort.Slice(report.ErrorGroups, func(i, j int) bool {
+		a, b := report.ErrorGroups[i], report.ErrorGroups[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Fingerprint != b.Fingerprint {
+			return a.Fingerprint < b.Fingerprint
+		}
+		return a.Error < b.Error
+	})
+
+	slowest := append(slowestHeap(nil), b.slowest...)
+	sort.Slice(slowest, func(i, j int) bool { return slowest.Less(j, i) })
+	for _, s := range slowest {
+		report.Slowest = append(report.Slowest, s.execution)
+	}
+	return report
+}
+
+type fingerprintStats struct {
+	latency histogram
+	errors  int
+}
+
+func (f *fingerprintStats) summary(fingerprint string) FingerprintSummary {
+	return FingerprintSummary{
+		Fingerprint: fingerprint,
+		Count:       int(f.latency.count),
+		Errors:      f.errors,
+		TotalTimeMs: ms(f.latency.sum),
+		MeanMs:      ms(f.latency.mean()),
+		P50Ms:       ms(f.latency.quantile(0.50)),
+		P95Ms:       ms(f.latency.quantile(0.95)),
+		P99Ms:       ms(f.latency.quantile(0.99)),
+		MaxMs:       ms(f.latency.max),
+	}
+}
+
+// slowExecution is an execution in the order it was read.
+type slowExecution struct {
+	execution
+	order int
+}
+
+// slowestHeap is a heap of the slowest executions with the fastest on top, so
+// it can be popped to keep the slowest n. Of equally slow executions the one
+// read last is on top.
+type slowestHeap []slowExecution
+
+func (h slowestHeap) Len() int { return len(h) }
+func (h slowestHeap) Less(i, j int) bool {
+	if h[i].DurationMs != h[j].DurationMs {
+		return h[i].DurationMs < h[j].DurationMs
+	}
+	return h[i].order > h[j].order
+}
+func (h slowestHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *slowestHeap) Push(x any)   { *h = append(*h, x.(slowExecution)) }
+func (h *slowestHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// topBy returns the n summaries with the highest value, ties broken by fingerprint.
+func topBy(summaries []FingerprintSummary, n int, value func(FingerprintSummary) float64) []FingerprintSummary {
+	sorted := append([]FingerprintSummary(nil), summaries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := value(sorted[i]), value(sorted[j])
+		if a != b {
+			return a > b
+		}
+		return sorted[i].Fingerprint < sorted[j].Fingerprint
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func formatMs(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 2, 64)
+}
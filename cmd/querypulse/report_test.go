@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testLogs = `{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":"query success","query":"select * from users where id = $1","args":[1],"took_ms":1.5}
+{"time":"2024-01-01T00:00:01Z","level":"INFO","msg":"query success","query":"select * from users where id = $1","args":[2],"took_ms":3.5}
+{"time":"2024-01-01T00:00:02Z","level":"WARN","msg":"slow query","query":"select * from orders","args":[],"took_ms":250}
+{"time":"2024-01-01T00:00:03Z","level":"ERROR","msg":"query error","query":"insert into t values ($1)","args":["x"],"took_ms":0.3,"error":"duplicate key"}
+not json
+{"time":"2024-01-01T00:00:04Z","level":"INFO","msg":"started"}
+{"time":"2024-01-01T00:00:05Z","level":"INFO","msg":"query success","db":{"query":"select * from orders","took_ms":50}}
+`
+
+func TestReport_json(t *testing.T) {
+	var out bytes.Buffer
+	err := run([]string{"report", "-format", "json", "-n", "2"}, strings.NewReader(testLogs), &out)
+	assert.NoError(t, err)
+
+	var report Report
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 5, report.Queries)
+	assert.Equal(t, 1, report.Errors)
+	assert.InDelta(t, 305.3, report.TotalTimeMs, 0.001)
+
+	if assert.Len(t, report.ByTotalTime, 2) {
+		assert.Equal(t, "select * from orders", report.ByTotalTime[0].Fingerprint)
+		assert.Equal(t, 2, report.ByTotalTime[0].Count)
+		assert.InEpsilon(t, 50.0, report.ByTotalTime[0].P50Ms, 0.2, "percentiles are approximate")
+		assert.Equal(t, 250.0, report.ByTotalTime[0].P99Ms)
+	}
+	assert.Equal(t, "select * from orders", report.ByCount[0].Fingerprint)
+	assert.Equal(t, "select * from users where id = ?", report.ByCount[1].Fingerprint)
+	assert.Equal(t, []ErrorSummary{{Fingerprint: "insert into t values (...)", Error: "duplicate key", Count: 1}}, report.ErrorGroups)
+
+	if assert.Len(t, report.Slowest, 2) {
+		assert.Equal(t, 250.0, report.Slowest[0].DurationMs)
+		assert.Equal(t, "2024-01-01T00:00:02Z", report.Slowest[0].Time)
+	}
+	var histogram int
+	for _, b := range report.Histogram {
+		histogram += b.Count
+	}
+	assert.Equal(t, 5, histogram)
+}
+
+func TestReportBuilder_slowest(t *testing.T) {
+	b := newReportBuilder(3)
+	for i, d := range []float64{5, 1, 9, 5, 7, 2, 9} {
+		b.add(execution{Query: "select 1", DurationMs: d, Time: strconv.Itoa(i)})
+	}
+	report := b.build()
+	var slowest []string
+	for _, e := range report.Slowest {
+		slowest = append(slowest, e.Time)
+	}
+	assert.Equal(t, []string{"2", "6", "4"}, slowest, "the slowest, the first read of equally slow ones first")
+	assert.Equal(t, 7, report.ByCount[0].Count)
+	assert.Equal(t, 9.0, report.ByCount[0].MaxMs)
+}
+
+func TestReport_formats(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"report"}, strings.NewReader(testLogs), &out))
+	assert.Contains(t, out.String(), "Top by total time")
+	assert.Contains(t, out.String(), "select * from users where id = ?")
+	assert.Contains(t, out.String(), `["x"]`)
+
+	out.Reset()
+	assert.NoError(t, run([]string{"report", "-format", "markdown"}, strings.NewReader(testLogs), &out))
+	assert.Contains(t, out.String(), "## Top by p99")
+	assert.Contains(t, out.String(), "| 1 | `insert into t values (...)` | duplicate key |")
+
+	assert.Error(t, run([]string{"report", "-format", "xml"}, strings.NewReader(testLogs), &out))
+	assert.EqualError(t, run([]string{"report", "-n", "-1"}, strings.NewReader(testLogs), &out), "-n must be at least 1, got -1")
+}
+
+func TestReport_durationUnit(t *testing.T) {
+	logs := `{"query":"select 1","took_us":2500}`
+	var executions []execution
+	err := readLogs(strings.NewReader(logs), keys{query: "query", duration: "took_us", unit: time.Microsecond}, func(e execution) {
+		executions = append(executions, e)
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, executions, 1) {
+		assert.Equal(t, 2.5, executions[0].DurationMs)
+	}
+}
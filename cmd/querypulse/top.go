@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+type topOptions struct {
+	sortBy string
+	top    int
+	driver string
+	color  bool
+}
+
+// topRow is one fingerprint in the top table.
+type topRow struct {
+	driver      string
+	fingerprint string
+	stats       querypulse.FingerprintStats
+	qps         float64
+	// timePerSec is the milliseconds of database time per second since the last refresh.
+	timePerSec float64
+	errorRate  float64
+}
+
+func topCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	url := fs.String("url", "http://localhost:6060/debug/querypulse", "URL serving querypulse.Stats, or expvar's /debug/vars")
+	interval := fs.Duration("interval", 2*time.Second, "how often to refresh")
+	once := fs.Bool("once", false, "print one table and exit")
+	opts := topOptions{}
+	fs.StringVar(&opts.sortBy, "sort", "time", "sort by time, total, qps, errors, p99 or inflight")
+	fs.IntVar(&opts.top, "n", 20, "number of fingerprints to show")
+	fs.StringVar(&opts.driver, "driver", "", "only show this driver")
+	noColor := fs.Bool("no-color", false, "don't highlight queries in flight")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts.color = !*noColor
+	if _, ok := sortKeys[opts.sortBy]; !ok {
+		return fmt.Errorf("unknown sort %q", opts.sortBy)
+	}
+	if opts.top < 1 {
+		return fmt.Errorf("-n must be at least 1, got %d", opts.top)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	client := &http.Client{Timeout: *interval + 5*time.Second}
+
+	var prev *querypulse.StatsSnapshot
+	var prevAt time.Time
+	for {
+		snap, err := fetchSnapshot(ctx, client, *url)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if !*once {
+			// clear the screen
+			fmt.Fprint(stdout, "\033[H\033[2J")
+		}
+		fmt.Fprintf(stdout, "querypulse top  %s  %s\n\n", *url, now.Format(time.TimeOnly))
+		if err := renderTop(stdout, prev, snap, now.Sub(prevAt), opts); err != nil {
+			return err
+		}
+		if *once {
+			return nil
+		}
+		prev, prevAt = snap, now
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// fetchSnapshot gets a querypulse.StatsSnapshot from a Stats handler, or from
+// the first expvar variable that holds one.
+func fetchSnapshot(ctx context.Context, client *http.Client, url string) (*querypulse.StatsSnapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	if _, ok := vars["drivers"]; !ok {
+		// expvar, find the variable published with Stats.PublishExpvar
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var v map[string]json.RawMessage
+			if json.Unmarshal(vars[name], &v) == nil && v["drivers"] != nil {
+				vars = v
+				break
+			}
+		}
+	}
+	raw, ok := vars["drivers"]
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't serve querypulse stats", url)
+	}
+	snap := &querypulse.StatsSnapshot{}
+	if err := json.Unmarshal(raw, &snap.Drivers); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return snap, nil
+}
+
+var sortKeys = map[string]func(topRow) float64{
+	"time":     func(r topRow) float64 { return r.timePerSec },
+	"total":    func(r topRow) float64 { return r.stats.TotalTimeMs },
+	"qps":      func(r topRow) float64 { return r.qps },
+	"errors":   func(r topRow) float64 { return r.errorRate },
+	"p99":      func(r topRow) float64 { return r.stats.P99Ms },
+	"inflight": func(r topRow) float64 { return float64(r.stats.InFlight) },
+}
+
+// renderTop prints a snapshot. Rates are worked out from the previous
+// snapshot, which is nil on the first refresh.
+func renderTop(w io.Writer, prev *querypulse.StatsSnapshot, cur *querypulse.StatsSnapshot, elapsed time.Duration, opts topOptions) error {
+	var rows []topRow
+	drivers := make([]string, 0, len(cur.Drivers))
+	for name := range cur.Drivers {
+		if opts.driver == "" || opts.driver == name {
+			drivers = append(drivers, name)
+		}
+	}
+	sort.Strings(drivers)
+
+	for _, name := range drivers {
+		d := cur.Drivers[name]
+		fmt.Fprintf(w, "%s: %d queries, %d errors, %d in flight", name, d.Queries, d.Errors, d.InFlight)
+		if d.Pool != nil {
+			fmt.Fprintf(w, ", pool %d/%d in use, %d waits", d.Pool.InUse, d.Pool.OpenConnections, d.Pool.WaitCount)
+		}
+		fmt.Fprintln(w)
+
+		for fingerprint, f := range d.Fingerprints {
+			row := topRow{driver: name, fingerprint: fingerprint, stats: f}
+			count, errors, total := f.Count, f.Errors, f.TotalTimeMs
+			if prev != nil && elapsed > 0 {
+				p := prev.Drivers[name].Fingerprints[fingerprint]
+				count, errors, total = count-p.Count, errors-p.Errors, total-p.TotalTimeMs
+				row.qps = float64(count) / elapsed.Seconds()
+				row.timePerSec = total / elapsed.Seconds()
+			}
+			if count > 0 {
+				row.errorRate = float64(errors) / float64(count)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	key := sortKeys[opts.sortBy]
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := key(rows[i]), key(rows[j])
+		if a != b {
+			return a > b
+		}
+		if rows[i].stats.TotalTimeMs != rows[j].stats.TotalTimeMs {
+			return rows[i].stats.TotalTimeMs > rows[j].stats.TotalTimeMs
+		}
+		return rows[i].fingerprint < rows[j].fingerprint
+	})
+	if len(rows) > opts.top {
+		rows = rows[:opts.top]
+	}
+
+	fmt.Fprintln(w)
+	var table bytes.Buffer
+	tw := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+	header := "INFLIGHT\tQPS\tERR%\tMS/S\tTOTAL MS\tCOUNT\tP50 MS\tP95 MS\tP99 MS\tFINGERPRINT"
+	if len(drivers) > 1 {
+		header = "DRIVER\t" + header
+	}
+	fmt.Fprintln(tw, header)
+	for _, r := range rows {
+		if len(drivers) > 1 {
+			fmt.Fprintf(tw, "%s\t", r.driver)
+		}
+		fmt.Fprintf(tw, "%d\t%.1f\t%.1f\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", r.stats.InFlight, r.qps, 100*r.errorRate,
+			formatMs(r.timePerSec), formatMs(r.stats.TotalTimeMs), r.stats.Count,
+			formatMs(r.stats.P50Ms), formatMs(r.stats.P95Ms), formatMs(r.stats.P99Ms), truncate(r.fingerprint))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// highlight the queries in flight after aligning, so the escape codes don't count towards the widths
+	lines := strings.SplitAfter(table.String(), "\n")
+	for i, line := range lines {
+		if opts.color && i > 0 && i <= len(rows) && rows[i-1].stats.InFlight > 0 {
+			line = "\033[1;33m" + strings.TrimSuffix(line, "\n") + "\033[0m\n"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
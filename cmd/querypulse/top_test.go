@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+func TestTop_once(t *testing.T) {
+	stats := querypulse.NewStats()
+	server := httptest.NewServer(stats)
+	defer server.Close()
+
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"top", "-once", "-url", server.URL}, nil, &out))
+	assert.Contains(t, out.String(), "INFLIGHT")
+
+	// the stats published with expvar, next to the other variables
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"cmdline":    []string{"app"},
+			"querypulse": stats.Snapshot(),
+		})
+	}))
+	defer server.Close()
+	out.Reset()
+	assert.NoError(t, run([]string{"top", "-once", "-url", server.URL}, nil, &out))
+	assert.Contains(t, out.String(), "INFLIGHT")
+
+	assert.EqualError(t, run([]string{"top", "-once", "-n", "0", "-url", server.URL}, nil, &out), "-n must be at least 1, got 0")
+}
+
+func TestRenderTop(t *testing.T) {
+	prev := &querypulse.StatsSnapshot{Drivers: map[string]querypulse.DriverStats{
+		"postgres": {Fingerprints: map[string]querypulse.FingerprintStats{
+			"select ?":           {Count: 10, TotalTimeMs: 10},
+			"update t set x = ?": {Count: 1, TotalTimeMs: 50},
+		}},
+	}}
+	cur := &querypulse.StatsSnapshot{Drivers: map[string]querypulse.DriverStats{
+		"postgres": {Queries: 41, Errors: 2, InFlight: 1, Fingerprints: map[string]querypulse.FingerprintStats{
+			"select ?":           {Count: 30, Errors: 2, TotalTimeMs: 30},
+			"update t set x = ?": {Count: 2, TotalTimeMs: 100, InFlight: 1},
+			"delete from t":      {Count: 1, TotalTimeMs: 1},
+		}},
+	}}
+
+	var out bytes.Buffer
+	err := renderTop(&out, prev, cur, 2*time.Second, topOptions{sortBy: "qps", top: 2, color: true})
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !assert.Len(t, lines, 5) {
+		return
+	}
+	assert.Equal(t, "postgres: 41 queries, 2 errors, 1 in flight", lines[0])
+	assert.Regexp(t, `^0\s+10\.0\s+10\.0\s+10\.00\s+30\.00\s+30 .* select \?$`, lines[3])
+	assert.True(t, strings.HasPrefix(lines[4], "\033[1;33m1 "), "queries in flight are highlighted")
+	assert.Contains(t, lines[4], "25.00")
+}
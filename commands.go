@@ -18,6 +18,8 @@ type conn interface {
 	driver.Conn
 	driver.ConnPrepareContext
 	driver.ConnBeginTx
+	driver.Validator
+	unwrap() driver.Conn
 }
 
 var (
@@ -49,6 +51,10 @@ func Register(driverName string, options Options) (string, error) {
 		return "", err
 	}
 
+	if options.DriverName == "" {
+		options.DriverName = driverName
+	}
+
 	regMu.Lock()
 	defer regMu.Unlock()
 	registerName := fmt.Sprintf("%s-zipkinsql-%d", driverName, len(sql.Drivers()))
@@ -59,6 +65,7 @@ func Register(driverName string, options Options) (string, error) {
 
 // Wrap takes a SQL driver and wraps it.
 func Wrap(d driver.Driver, options Options) driver.Driver {
+	options.setDriverName(d)
 	return wrapDriver(d, options)
 }
 
@@ -67,21 +74,52 @@ func (d zDriver) Open(name string) (driver.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return wrapConn(c, d.options), nil
+	dial := func(ctx context.Context) (driver.Conn, error) {
+		return d.parent.Open(name)
+	}
+	return wrapConn(context.Background(), c, dial, d.options), nil
 }
 
 // WrapConn allows an existing driver.Conn to be wrapped.
 func WrapConn(c driver.Conn, options Options) driver.Conn {
-	return wrapConn(c, options)
+	options.setDriverName(c)
+	return wrapConn(context.Background(), c, nil, options)
 }
 
 // zConn implements driver.Conn
 type zConn struct {
 	parent driver.Conn
+	state  *connState
 
 	options Options
 }
 
+// connState is shared by a connection and the statements and transactions
+// created from it.
+type connState struct {
+	// id identifies the connection.
+	id uint64
+	// backendPID is the server's ID for the connection when Options.BackendPID is set.
+	backendPID int64
+	inTx       bool
+	// txID identifies the open transaction.
+	txID uint64
+	// dial opens another connection like this one, or is nil when it can't.
+	dial func(ctx context.Context) (driver.Conn, error)
+}
+
+func newConn(ctx context.Context, parent driver.Conn, dial func(ctx context.Context) (driver.Conn, error), options Options) *zConn {
+	c := &zConn{parent: parent, state: &connState{id: nextConnID(), dial: dial}, options: options}
+	if options.BackendPID != "" {
+		c.state.backendPID = backendPID(ctx, parent, options.BackendPID)
+	}
+	c.options.Timeline.connOpened(c.state.id)
+	if options.Stats != nil {
+		options.Stats.connOpened(options.DriverName, c.state.id, c.state.backendPID)
+	}
+	return c
+}
+
 func (c zConn) Ping(ctx context.Context) error {
 	if pinger, ok := c.parent.(driver.Pinger); ok {
 		return pinger.Ping(ctx)
@@ -90,13 +128,20 @@ func (c zConn) Ping(ctx context.Context) error {
 }
 
 func (c zConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	if _, ok := c.parent.(driver.ExecerContext); ok && c.options.hasTimeout() {
+		// route through the context aware method so the default timeout applies
+		return c.ExecContext(context.Background(), query, namedValues(args))
+	}
 	if exec, ok := c.parent.(driver.Execer); ok {
-		start := time.Now()
-		res, err := exec.Exec(query, args)
-		c.options.onComplete(context.Background(), query, args, time.Since(start), err)
-		if err != nil {
-			return res, err
+		if err := c.options.guard(context.Background(), query, query, toAnyArgs(args)); err != nil {
+			return nil, err
 		}
+		var res driver.Result
+		_, err := c.options.run(context.Background(), c.state, OpExec, query, query, namedValues(args), func(ctx context.Context) (driver.Rows, error) {
+			var err error
+			res, err = exec.Exec(query, args)
+			return nil, err
+		})
 		return res, err
 	}
 
@@ -105,9 +150,20 @@ func (c zConn) Exec(query string, args []driver.Value) (driver.Result, error) {
 
 func (c zConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
 	if execCtx, ok := c.parent.(driver.ExecerContext); ok {
-		start := time.Now()
-		res, err := execCtx.ExecContext(ctx, query, args)
-		c.options.onCompleteNamed(ctx, query, args, time.Since(start), err)
+		original := query
+		query, args, err := c.options.rewrite(ctx, query, args)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.options.guard(ctx, original, query, argsNamed(args)); err != nil {
+			return nil, err
+		}
+		var res driver.Result
+		_, err = c.options.run(ctx, c.state, OpExec, original, query, args, func(ctx context.Context) (driver.Rows, error) {
+			var err error
+			res, err = execCtx.ExecContext(ctx, query, args)
+			return nil, err
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -118,15 +174,17 @@ func (c zConn) ExecContext(ctx context.Context, query string, args []driver.Name
 }
 
 func (c zConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	if _, ok := c.parent.(driver.QueryerContext); ok && c.options.hasTimeout() {
+		// route through the context aware method so the default timeout applies
+		return c.QueryContext(context.Background(), query, namedValues(args))
+	}
 	if queryer, ok := c.parent.(driver.Queryer); ok {
-		start := time.Now()
-		rows, err := queryer.Query(query, args)
-		c.options.onComplete(context.Background(), query, args, time.Since(start), err)
-		if err != nil {
-			return rows, err
+		if err := c.options.guard(context.Background(), query, query, toAnyArgs(args)); err != nil {
+			return nil, err
 		}
-
-		return rows, nil
+		return c.options.run(context.Background(), c.state, OpQuery, query, query, namedValues(args), func(ctx context.Context) (driver.Rows, error) {
+			return queryer.Query(query, args)
+		})
 	}
 
 	return nil, driver.ErrSkip
@@ -134,9 +192,17 @@ func (c zConn) Query(query string, args []driver.Value) (driver.Rows, error) {
 
 func (c zConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
 	if queryerCtx, ok := c.parent.(driver.QueryerContext); ok {
-		start := time.Now()
-		rows, err := queryerCtx.QueryContext(ctx, query, args)
-		c.options.onCompleteNamed(ctx, query, args, time.Since(start), err)
+		original := query
+		query, args, err := c.options.rewrite(ctx, query, args)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.options.guard(ctx, original, query, argsNamed(args)); err != nil {
+			return nil, err
+		}
+		rows, err := c.options.run(ctx, c.state, OpQuery, original, query, args, func(ctx context.Context) (driver.Rows, error) {
+			return queryerCtx.QueryContext(ctx, query, args)
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -148,41 +214,81 @@ func (c zConn) QueryContext(ctx context.Context, query string, args []driver.Nam
 }
 
 func (c zConn) Prepare(query string) (driver.Stmt, error) {
+	if err := c.options.guard(context.Background(), query, query, nil); err != nil {
+		return nil, err
+	}
+	start := time.Now()
 	stmt, err := c.parent.Prepare(query)
+	c.options.Timeline.prepared(c.state.id, query, start, err)
 	if err != nil {
 		return nil, err
 	}
 
-	return wrapStmt(stmt, query, c.options), nil
+	return wrapStmt(stmt, query, query, c.state, c.options), nil
 }
 
 func (c *zConn) Close() error {
+	if c.state.inTx {
+		c.options.Transactions.abandoned(c.state.txID)
+	}
+	c.options.Timeline.connClosed(c.state.id)
+	if c.options.Stats != nil {
+		c.options.Stats.connClosed(c.options.DriverName, c.state.id)
+	}
 	return c.parent.Close()
 }
 
+// IsValid asks the parent whether the connection can be reused. Like
+// database/sql, connections are valid when the parent can't tell.
+func (c *zConn) IsValid() bool {
+	if v, ok := c.parent.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *zConn) unwrap() driver.Conn {
+	return c.parent
+}
+
 func (c *zConn) Begin() (driver.Tx, error) {
 	return c.parent.Begin()
 }
 
-func (c *zConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+func (c *zConn) PrepareContext(ctx context.Context, original string) (driver.Stmt, error) {
+	query, _, err := c.options.rewrite(ctx, original, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.options.guard(ctx, original, query, nil); err != nil {
+		return nil, err
+	}
 
+	start := time.Now()
 	if prepCtx, ok := c.parent.(driver.ConnPrepareContext); ok {
 		stmt, err := prepCtx.PrepareContext(ctx, query)
+		c.options.Timeline.prepared(c.state.id, query, start, err)
 		if err != nil {
 			return nil, err
 		}
-		return wrapStmt(stmt, query, c.options), nil
+		return wrapStmt(stmt, original, query, c.state, c.options), nil
 
 	} else {
 		stmt, err := c.parent.Prepare(query)
+		c.options.Timeline.prepared(c.state.id, query, start, err)
 		if err != nil {
 			return nil, err
 		}
-		return wrapStmt(stmt, query, c.options), nil
+		return wrapStmt(stmt, original, query, c.state, c.options), nil
 	}
 }
 
 func (c *zConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if IsReadOnly(ctx) && !opts.ReadOnly {
+		err := &ReadOnlyError{Query: "BEGIN", Caller: callSite()}
+		c.options.report(ctx, Event{Query: err.Query, OriginalQuery: err.Query, Err: err})
+		return nil, err
+	}
 
 	if connBeginTx, ok := c.parent.(driver.ConnBeginTx); ok {
 		tx, err := connBeginTx.BeginTx(ctx, opts)
@@ -190,7 +296,12 @@ func (c *zConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx,
 		if err != nil {
 			return nil, err
 		}
-		return zTx{parent: tx, ctx: ctx, options: c.options}, nil
+		c.state.inTx, c.state.txID = true, nextTxID()
+		c.options.Timeline.txBegan(c.state.id, c.state.txID)
+		if c.options.Transactions != nil {
+			c.options.Transactions.begin(c.state.id, c.state.txID, callSite())
+		}
+		return zTx{parent: tx, ctx: ctx, state: c.state, options: c.options}, nil
 	}
 
 	tx, err := c.parent.Begin()
@@ -198,18 +309,29 @@ func (c *zConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx,
 	if err != nil {
 		return nil, err
 	}
+	c.state.inTx, c.state.txID = true, nextTxID()
+	c.options.Timeline.txBegan(c.state.id, c.state.txID)
+	if c.options.Transactions != nil {
+		c.options.Transactions.begin(c.state.id, c.state.txID, callSite())
+	}
 
-	return zTx{parent: tx, ctx: ctx, options: c.options}, nil
+	return zTx{parent: tx, ctx: ctx, state: c.state, options: c.options}, nil
 }
 
 // zStmt implements driver.Stmt
 type zStmt struct {
-	parent  driver.Stmt
-	query   string
-	options Options
+	parent   driver.Stmt
+	original string
+	query    string
+	state    *connState
+	options  Options
+	leak     *leakHandle
 }
 
 func (s zStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if _, ok := s.parent.(driver.StmtExecContext); ok && s.options.hasTimeout() {
+		return s.ExecContext(context.Background(), namedValues(args))
+	}
 	res, err := s.parent.Exec(args)
 	if err != nil {
 		return nil, err
@@ -218,6 +340,8 @@ func (s zStmt) Exec(args []driver.Value) (driver.Result, error) {
 }
 
 func (s zStmt) Close() error {
+	s.leak.close()
+	s.options.Timeline.stmtClosed(s.state.id, s.query)
 	return s.parent.Close()
 }
 
@@ -226,10 +350,13 @@ func (s zStmt) NumInput() int {
 }
 
 func (s zStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if _, ok := s.parent.(driver.StmtQueryContext); ok && s.options.hasTimeout() {
+		return s.QueryContext(context.Background(), namedValues(args))
+	}
 
-	start := time.Now()
-	rows, err := s.parent.Query(args)
-	s.options.onComplete(context.Background(), s.query, args, time.Since(start), err)
+	rows, err := s.options.run(context.Background(), s.state, OpQuery, s.original, s.query, namedValues(args), func(ctx context.Context) (driver.Rows, error) {
+		return s.parent.Query(args)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -238,10 +365,13 @@ func (s zStmt) Query(args []driver.Value) (driver.Rows, error) {
 }
 
 func (s zStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	start := time.Now()
 	execContext := s.parent.(driver.StmtExecContext)
-	res, err := execContext.ExecContext(ctx, args)
-	s.options.onCompleteNamed(ctx, s.query, args, time.Since(start), err)
+	var res driver.Result
+	_, err := s.options.run(ctx, s.state, OpExec, s.original, s.query, args, func(ctx context.Context) (driver.Rows, error) {
+		var err error
+		res, err = execContext.ExecContext(ctx, args)
+		return nil, err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -250,12 +380,11 @@ func (s zStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (drive
 }
 
 func (s zStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-
-	start := time.Now()
 	// we already tested driver to implement StmtQueryContext
 	queryContext := s.parent.(driver.StmtQueryContext)
-	rows, err := queryContext.QueryContext(ctx, args)
-	s.options.onCompleteNamed(ctx, s.query, args, time.Since(start), err)
+	rows, err := s.options.run(ctx, s.state, OpQuery, s.original, s.query, args, func(ctx context.Context) (driver.Rows, error) {
+		return queryContext.QueryContext(ctx, args)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -267,13 +396,24 @@ func (s zStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driv
 type zTx struct {
 	parent  driver.Tx
 	ctx     context.Context
+	state   *connState
 	options Options
 }
 
 func (t zTx) Commit() error {
-	return t.parent.Commit()
+	txID := t.state.txID
+	t.state.inTx, t.state.txID = false, 0
+	err := t.parent.Commit()
+	t.options.Timeline.txEnded(txID, "commit", err)
+	t.options.Transactions.end(txID)
+	return err
 }
 
 func (t zTx) Rollback() error {
-	return t.parent.Rollback()
+	txID := t.state.txID
+	t.state.inTx, t.state.txID = false, 0
+	err := t.parent.Rollback()
+	t.options.Timeline.txEnded(txID, "rollback", err)
+	t.options.Transactions.end(txID)
+	return err
 }
@@ -3,7 +3,9 @@ package querypulse
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -308,6 +310,31 @@ func TestPrepare(t *testing.T) {
 	}
 }
 
+func TestNamedArgs(t *testing.T) {
+	var meta queryMeta
+	var events []Event
+	driverName, err := Register("sqlite3", Options{
+		OnSuccess: func(ctx context.Context, query string, args []any, duration time.Duration) {
+			meta = queryMeta{query: query, args: args}
+		},
+		OnEvent: func(ctx context.Context, event Event) {
+			events = append(events, event)
+		},
+	})
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("select :a, ?", sql.Named("a", 1), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{int64(1), int64(2)}, meta.args, "callbacks get plain values")
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, []any{sql.Named("a", int64(1)), int64(2)}, events[0].Args)
+	}
+}
+
 func TestNoCallback(t *testing.T) {
 	driverName, err := Register("sqlite3", Options{})
 	assert.NoError(t, err)
@@ -321,6 +348,41 @@ func TestNoCallback(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestRewrite(t *testing.T) {
+	var events []Event
+	driverName, err := Register("sqlite3", Options{
+		Rewrite: func(ctx context.Context, query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+			return strings.Replace(query, "$1", "$1 + 1", 1), args, nil
+		},
+		OnEvent: func(ctx context.Context, event Event) {
+			events = append(events, event)
+		},
+	})
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	var n int
+	err = db.QueryRowContext(ctx, "select $1", 1).Scan(&n)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	stmt, err := db.PrepareContext(ctx, "select $1")
+	assert.NoError(t, err)
+	err = stmt.QueryRowContext(ctx, 2).Scan(&n)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Len(t, events, 2)
+	for _, ev := range events {
+		assert.Equal(t, "select $1", ev.OriginalQuery)
+		assert.Equal(t, "select $1 + 1", ev.Query)
+		assert.Equal(t, "select ? + ?", ev.Fingerprint, "fingerprints the rewritten query")
+	}
+}
+
 func assertQuery(t *testing.T, meta queryMeta, expectedQuery string, expectedArgs []any, minDuration time.Duration, maxDuration time.Duration) {
 	assert.Equal(t, expectedQuery, meta.query, "query doesnt match")
 	assert.Equal(t, expectedArgs, meta.args, "args dont match")
@@ -390,3 +452,18 @@ func getDB(onSuccess func(meta queryMeta), onError func(meta queryMeta)) (*sql.D
 	db.SetMaxOpenConns(1)
 	return db, err
 }
+
+// openDB opens the sqlite test database with a driver registered with
+// options, collecting the events it reports. It is closed when the test ends.
+func openDB(t *testing.T, options Options) (*sql.DB, *[]Event) {
+	t.Helper()
+	var events []Event
+	options.OnEvent = func(ctx context.Context, event Event) { events = append(events, event) }
+	driverName, err := Register("sqlite3", options)
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db, &events
+}
@@ -0,0 +1,46 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backendPID asks the server for its ID for a new connection. It returns zero
+// when the dialect has no such ID or the query fails.
+func backendPID(ctx context.Context, conn driver.Conn, dialect Dialect) int64 {
+	var query string
+	switch dialect {
+	case DialectPostgres:
+		query = "SELECT pg_backend_pid()"
+	case DialectMySQL:
+		query = "SELECT CONNECTION_ID()"
+	default:
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	text, err := queryText(ctx, conn, query, nil)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	return pid
+}
+
+// UnwrapConn returns the parent driver's connection from a connection wrapped
+// by querypulse, such as the one sql.Conn.Raw passes to its func, so driver
+// specific APIs can be used. Other values are returned as they are.
+//
+//	err := conn.Raw(func(driverConn any) error {
+//		pgxConn := querypulse.UnwrapConn(driverConn).(*stdlib.Conn).Conn()
+//		...
+//	})
+func UnwrapConn(driverConn any) any {
+	if c, ok := driverConn.(interface{ unwrap() driver.Conn }); ok {
+		return c.unwrap()
+	}
+	return driverConn
+}
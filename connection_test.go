@@ -0,0 +1,136 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnStats(t *testing.T) {
+	stats := NewStats()
+	var events []Event
+	driverName, err := Register("sqlite3", Options{Stats: stats, OnEvent: func(_ context.Context, ev Event) { events = append(events, ev) }})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("select 1")
+	assert.NoError(t, err)
+	_, err = db.Exec("not a valid statement")
+	assert.Error(t, err)
+
+	conns := stats.Snapshot().Drivers["sqlite3"].Connections
+	if !assert.Len(t, conns, 1) {
+		return
+	}
+	assert.Equal(t, events[0].ConnID, conns[0].ID)
+	assert.Equal(t, events[1].ConnID, conns[0].ID)
+	assert.NotZero(t, conns[0].ID)
+	assert.Equal(t, int64(2), conns[0].Queries)
+	assert.Equal(t, int64(1), conns[0].Errors)
+	assert.Greater(t, conns[0].BusyTimeMs, 0.0)
+	assert.GreaterOrEqual(t, conns[0].AgeMs, conns[0].BusyTimeMs)
+
+	assert.NoError(t, db.Close())
+	assert.Empty(t, stats.Snapshot().Drivers["sqlite3"].Connections)
+}
+
+// pidConn is a driver.Conn that answers every query with one number.
+type pidConn struct {
+	ctxConn
+	query string
+}
+
+func (c *pidConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.query = query
+	return &pidRows{}, nil
+}
+
+type pidRows struct{ done bool }
+
+func (r *pidRows) Columns() []string { return []string{"pid"} }
+func (r *pidRows) Close() error      { return nil }
+func (r *pidRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(4242)
+	return nil
+}
+
+func TestBackendPID(t *testing.T) {
+	var events []Event
+	parent := &pidConn{}
+	conn := WrapConn(parent, Options{BackendPID: DialectPostgres, OnEvent: func(_ context.Context, ev Event) { events = append(events, ev) }}).(*zConn)
+	assert.Equal(t, "SELECT pg_backend_pid()", parent.query)
+
+	_, err := conn.ExecContext(ctx, "select 1", nil)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, int64(4242), events[0].BackendPID)
+	}
+
+	conn = WrapConn(&pidConn{}, Options{BackendPID: DialectSQLite}).(*zConn)
+	assert.Zero(t, conn.state.backendPID)
+}
+
+// stdlibConn is a driver.Conn with the optional interfaces of pgx's stdlib.Conn.
+type stdlibConn struct {
+	ctxConn
+	args    []any
+	resets  int
+	invalid bool
+	closed  int
+}
+
+func (c *stdlibConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	for _, arg := range args {
+		c.args = append(c.args, arg.Value)
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// CheckNamedValue accepts any value, like pgx does.
+func (c *stdlibConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+func (c *stdlibConn) ResetSession(ctx context.Context) error   { c.resets++; return nil }
+func (c *stdlibConn) IsValid() bool                            { return !c.invalid }
+func (c *stdlibConn) Close() error                             { c.closed++; return nil }
+
+type stdlibConnector struct{ conn *stdlibConn }
+
+func (c stdlibConnector) Connect(ctx context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c stdlibConnector) Driver() driver.Driver                            { return nil }
+
+func TestWrapConnector_optionalInterfaces(t *testing.T) {
+	parent := &stdlibConn{}
+	db := sql.OpenDB(WrapConnector(stdlibConnector{conn: parent}, Options{}))
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// database/sql would reject a []string without the parent's CheckNamedValue
+	_, err := db.Exec("select $1", []string{"a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []any{[]string{"a", "b"}}, parent.args)
+
+	_, err = db.Exec("select 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, parent.resets)
+
+	conn, err := db.Conn(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Raw(func(driverConn any) error {
+		assert.Same(t, parent, UnwrapConn(driverConn))
+		return nil
+	}))
+	assert.Equal(t, "not a conn", UnwrapConn("not a conn"))
+
+	parent.invalid = true
+	assert.NoError(t, conn.Close())
+	assert.Equal(t, 1, parent.closed, "invalid connections aren't returned to the pool")
+}
@@ -14,6 +14,7 @@ var (
 // WrapConnector allows wrapping a database driver.Connector which eliminates
 // the need to register it as an available driver.Driver.
 func WrapConnector(dc driver.Connector, options Options) driver.Connector {
+	options.setDriverName(dc.Driver())
 
 	return &zDriver{
 		parent:    dc.Driver(),
@@ -37,12 +38,12 @@ func wrapDriver(d driver.Driver, o Options) driver.Driver {
 	return struct{ driver.Driver }{zDriver{parent: d, options: o}}
 }
 
-func wrapConn(parent driver.Conn, options Options) driver.Conn {
+func wrapConn(ctx context.Context, parent driver.Conn, dial func(ctx context.Context) (driver.Conn, error), options Options) driver.Conn {
 	var (
 		n, hasNameValueChecker = parent.(driver.NamedValueChecker)
 		s, hasSessionResetter  = parent.(driver.SessionResetter)
 	)
-	c := &zConn{parent: parent, options: options}
+	c := newConn(ctx, parent, dial, options)
 	switch {
 	case !hasNameValueChecker && !hasSessionResetter:
 		return c
@@ -66,7 +67,7 @@ func wrapConn(parent driver.Conn, options Options) driver.Conn {
 	panic("unreachable")
 }
 
-func wrapStmt(stmt driver.Stmt, query string, options Options) driver.Stmt {
+func wrapStmt(stmt driver.Stmt, original string, query string, state *connState, options Options) driver.Stmt {
 	var (
 		_, hasExeCtx    = stmt.(driver.StmtExecContext)
 		_, hasQryCtx    = stmt.(driver.StmtQueryContext)
@@ -74,7 +75,8 @@ func wrapStmt(stmt driver.Stmt, query string, options Options) driver.Stmt {
 		n, hasNamValChk = stmt.(driver.NamedValueChecker)
 	)
 
-	s := zStmt{parent: stmt, query: query, options: options}
+	s := zStmt{parent: stmt, original: original, query: query, state: state, options: options}
+	s.leak = options.Leaks.track(LeakStmt, query, state.id)
 	switch {
 	case !hasExeCtx && !hasQryCtx && !hasColConv && !hasNamValChk:
 		return struct {
@@ -191,7 +193,7 @@ func (d zDriver) Connect(ctx context.Context) (driver.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &zConn{parent: c, options: d.options}, nil
+	return wrapConn(ctx, c, d.connector.Connect, d.options), nil
 }
 
 func (d zDriver) Driver() driver.Driver {
@@ -0,0 +1,219 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dialect is the SQL dialect spoken by the wrapped driver.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+	DialectMySQL    Dialect = "mysql"
+)
+
+// Explain captures query plans for slow queries. Set it on Options.Explain.
+//
+// When a query takes longer than Threshold, EXPLAIN is run in the background
+// with the same args on a new connection from the wrapped driver. Plans are
+// cached per Fingerprint and attached to the Event of later slow executions.
+// Queries that write are never explained with ANALYZE.
+//
+// Explain is not available for connections wrapped with WrapConn because there
+// is no way to open another connection. An Explain must not be copied after use.
+type Explain struct {
+	Dialect Dialect
+	// Threshold is how long a query must take to be explained. Defaults to a
+	// second. A negative Threshold explains every query.
+	Threshold time.Duration
+	// Analyze runs EXPLAIN ANALYZE for queries that don't write. This runs the
+	// query again. MySQL then returns a text tree rather than JSON.
+	Analyze bool
+	// RefreshInterval is how long a plan is used before it's captured again.
+	// Defaults to 10 minutes.
+	RefreshInterval time.Duration
+	// Timeout limits how long capturing a plan may take. Defaults to 10 seconds.
+	Timeout time.Duration
+	// OnPlan is called with every plan captured.
+	OnPlan func(plan Plan)
+
+	mu    sync.Mutex
+	plans map[string]*planEntry
+}
+
+// Plan is a query plan captured by Explain.
+type Plan struct {
+	Fingerprint string
+	// Query is the query that was explained, with the EXPLAIN prefix.
+	Query string
+	// Plan is the output of EXPLAIN. It is JSON for Postgres, JSON for MySQL
+	// unless Explain.Analyze gives its text tree, and one line per row of
+	// EXPLAIN QUERY PLAN for SQLite.
+	Plan       string
+	CapturedAt time.Time
+	Err        error
+}
+
+type planEntry struct {
+	plan      *Plan
+	capturing bool
+}
+
+// plan returns the cached plan for a slow query, starting a capture in the
+// background when there isn't a fresh one.
+func (e *Explain) plan(query string, fingerprint string, args []driver.NamedValue, dial func(ctx context.Context) (driver.Conn, error)) *Plan {
+	explain, ok := e.statement(query)
+	if !ok || dial == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.plans == nil {
+		e.plans = map[string]*planEntry{}
+	}
+	entry, ok := e.plans[fingerprint]
+	if !ok {
+		entry = &planEntry{}
+		e.plans[fingerprint] = entry
+	}
+	if entry.capturing || (entry.plan != nil && time.Since(entry.plan.CapturedAt) < e.refreshInterval()) {
+		return entry.plan
+	}
+	entry.capturing = true
+	go e.capture(fingerprint, explain, append([]driver.NamedValue(nil), args...), dial)
+	return entry.plan
+}
+
+func (e *Explain) capture(fingerprint string, explain string, args []driver.NamedValue, dial func(ctx context.Context) (driver.Conn, error)) {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	text, err := runExplain(ctx, dial, explain, args)
+	plan := &Plan{Fingerprint: fingerprint, Query: explain, Plan: text, CapturedAt: time.Now(), Err: err}
+
+	e.mu.Lock()
+	entry := e.plans[fingerprint]
+	entry.plan = plan
+	entry.capturing = false
+	e.mu.Unlock()
+
+	if e.OnPlan != nil {
+		e.OnPlan(*plan)
+	}
+}
+
+func (e *Explain) threshold() time.Duration {
+	if e.Threshold == 0 {
+		return time.Second
+	}
+	return e.Threshold
+}
+
+func (e *Explain) refreshInterval() time.Duration {
+	if e.RefreshInterval <= 0 {
+		return 10 * time.Minute
+	}
+	return e.RefreshInterval
+}
+
+// statement returns the EXPLAIN statement for a query, or false if the query
+// can't be explained.
+func (e *Explain) statement(query string) (string, bool) {
+	stmts := statements(scan(query, e.Dialect))
+	if len(stmts) != 1 || stmts[0][0].is("EXPLAIN") {
+		return "", false
+	}
+	switch v, _ := verb(stmts[0]); v {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "VALUES", "TABLE", "MERGE":
+	default:
+		return "", false
+	}
+	analyze := e.Analyze && !isWrite(query)
+
+	switch e.Dialect {
+	case DialectPostgres:
+		if analyze {
+			return "EXPLAIN (ANALYZE, FORMAT JSON) " + query, true
+		}
+		return "EXPLAIN (FORMAT JSON) " + query, true
+	case DialectSQLite:
+		return "EXPLAIN QUERY PLAN " + query, true
+	case DialectMySQL:
+		if analyze {
+			return "EXPLAIN ANALYZE " + query, true
+		}
+		return "EXPLAIN FORMAT=JSON " + query, true
+	}
+	return "", false
+}
+
+// runExplain runs an EXPLAIN statement on a new connection and returns its
+// output as text.
+func runExplain(ctx context.Context, dial func(ctx context.Context) (driver.Conn, error), explain string, args []driver.NamedValue) (string, error) {
+	conn, err := dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return queryText(ctx, conn, explain, args)
+}
+
+// queryText runs a query on a connection of the parent driver and returns
+// its rows as text, one line per row with tabs between the columns.
+func queryText(ctx context.Context, conn driver.Conn, query string, args []driver.NamedValue) (string, error) {
+	rows, err := driver.Rows(nil), driver.ErrSkip
+	if queryer, ok := conn.(driver.QueryerContext); ok {
+		rows, err = queryer.QueryContext(ctx, query, args)
+	}
+	if err == driver.ErrSkip {
+		var stmt driver.Stmt
+		stmt, err = conn.Prepare(query)
+		if err != nil {
+			return "", err
+		}
+		defer stmt.Close()
+		values := make([]driver.Value, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value
+		}
+		rows, err = stmt.Query(values)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	dest := make([]driver.Value, len(rows.Columns()))
+	for {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		cols := make([]string, len(dest))
+		for i, v := range dest {
+			if b, ok := v.([]byte); ok {
+				cols[i] = string(b)
+			} else {
+				cols[i] = fmt.Sprint(v)
+			}
+		}
+		lines = append(lines, strings.Join(cols, "\t"))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,79 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain_statement(t *testing.T) {
+	explain := &Explain{Dialect: DialectPostgres, Analyze: true}
+
+	stmt, ok := explain.statement("select * from users where id = $1")
+	assert.True(t, ok)
+	assert.Equal(t, "EXPLAIN (ANALYZE, FORMAT JSON) select * from users where id = $1", stmt)
+
+	stmt, ok = explain.statement("update users set age = 1 where id = $1")
+	assert.True(t, ok)
+	assert.Equal(t, "EXPLAIN (FORMAT JSON) update users set age = 1 where id = $1", stmt, "writes must not be analyzed")
+
+	stmt, ok = explain.statement("with gone as (delete from users returning id) select * from gone")
+	assert.True(t, ok)
+	assert.NotContains(t, stmt, "ANALYZE")
+
+	_, ok = explain.statement("create table users (id int)")
+	assert.False(t, ok)
+	_, ok = explain.statement("select 1; select 2")
+	assert.False(t, ok)
+	_, ok = explain.statement("explain analyze select 1")
+	assert.False(t, ok)
+}
+
+func TestExplain_threshold(t *testing.T) {
+	assert.Equal(t, time.Second, (&Explain{}).threshold(), "zero doesn't explain every query")
+	assert.Equal(t, -time.Nanosecond, (&Explain{Threshold: -1}).threshold())
+}
+
+func TestExplain(t *testing.T) {
+	plans := make(chan Plan, 1)
+	var events []Event
+	driverName, err := Register("sqlite3", Options{
+		Explain: &Explain{
+			Dialect:   DialectSQLite,
+			Threshold: -1,
+			OnPlan:    func(plan Plan) { plans <- plan },
+		},
+		OnEvent: func(ctx context.Context, event Event) { events = append(events, event) },
+	})
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(2)
+
+	_, err = db.Exec("create table explained (id int primary key, name text)")
+	assert.NoError(t, err)
+	defer db.Exec("drop table explained")
+
+	_, err = db.Exec("select name from explained where id = $1", 1)
+	assert.NoError(t, err)
+	assert.Nil(t, events[1].Plan, "the first plan is captured in the background")
+
+	select {
+	case plan := <-plans:
+		assert.NoError(t, plan.Err)
+		assert.Equal(t, "select name from explained where id = ?", plan.Fingerprint)
+		assert.Contains(t, plan.Plan, "explained")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no plan was captured")
+	}
+
+	_, err = db.Exec("select name from explained where id = $1", 2)
+	assert.NoError(t, err)
+	if assert.NotNil(t, events[2].Plan) {
+		assert.Contains(t, events[2].Plan.Plan, "explained")
+	}
+}
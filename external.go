@@ -0,0 +1,41 @@
+package querypulse
+
+import (
+	"context"
+	"time"
+)
+
+// StartQuery reports a query that doesn't go through database/sql, such as
+// one run by a native pgx connection through qspgx, as if a wrapped driver had
+// run it. ev holds what is known before the query runs: its Query, Args,
+// Operation and any connection or transaction IDs.
+//
+// It counts the query as in flight and returns the context to run it with,
+// which holds the query for QueryFromContext, and a func to call with the
+// query's error when it finishes. The func fills in the rest of the event and
+// passes it to Stats, Capture, Timeline, the context's budget and the
+// callbacks. Options that change or block queries, such as Rewrite, Guard,
+// timeouts and retries, aren't applied.
+func (o *Options) StartQuery(ctx context.Context, ev Event) (context.Context, func(err error)) {
+	operation := operationFrom(ctx)
+	ev.OperationID, ev.Attempt = operation.id, operation.attempt
+	if ev.OriginalQuery == "" {
+		ev.OriginalQuery = ev.Query
+	}
+	ev.Fingerprint = Fingerprint(ev.Query)
+	callCtx := withActiveQuery(ctx, ActiveQuery{Query: ev.Query, TxID: ev.TxID})
+	done := o.startStats(ev.Fingerprint)
+	start := time.Now()
+
+	return callCtx, func(err error) {
+		ev.Duration = time.Since(start)
+		done()
+		ev.Err = err
+		ev.ConnWait = connWait(ctx, start)
+		o.classifyEvent(&ev)
+		o.Timeline.query(ev.ConnID, ev, start)
+		o.Transactions.statement(ev.TxID, ev.Query)
+		o.spendBudget(ctx, ev)
+		o.report(ctx, ev)
+	}
+}
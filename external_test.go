@@ -0,0 +1,44 @@
+package querypulse
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartQuery(t *testing.T) {
+	var events []Event
+	stats := NewStats()
+	o := Options{Stats: stats, DriverName: "native", OnEvent: func(_ context.Context, ev Event) { events = append(events, ev) }}
+	budgetCtx := WithBudget(context.Background(), 10, 0)
+
+	queryCtx, finish := o.StartQuery(budgetCtx, Event{Query: "select $1", Args: []any{1}, Operation: OpQuery, BackendPID: 42})
+	q, ok := QueryFromContext(queryCtx)
+	assert.True(t, ok)
+	assert.Equal(t, "select $1", q.Query)
+	assert.Equal(t, int64(1), stats.Snapshot().Drivers["native"].InFlight)
+	finish(nil)
+
+	_, finish = o.StartQuery(budgetCtx, Event{Query: "insert into t values (1)", Operation: OpExec})
+	finish(errors.New("failed"))
+
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "select $1", events[0].OriginalQuery)
+		assert.Equal(t, "select ?", events[0].Fingerprint)
+		assert.Equal(t, []any{1}, events[0].Args)
+		assert.Equal(t, int64(42), events[0].BackendPID)
+		assert.Equal(t, 1, events[0].Attempt)
+		assert.NotZero(t, events[0].OperationID)
+		assert.EqualError(t, events[1].Err, "failed")
+		assert.Equal(t, CategoryOther, events[1].ErrorClass.Category)
+	}
+	snap := stats.Snapshot().Drivers["native"]
+	assert.Equal(t, int64(0), snap.InFlight)
+	assert.Equal(t, int64(2), snap.Queries)
+	assert.Equal(t, int64(1), snap.Errors)
+
+	budget, _ := BudgetFromContext(budgetCtx)
+	assert.Equal(t, 2, budget.Summary().Queries)
+}
@@ -0,0 +1,107 @@
+package querypulse
+
+import (
+	"strings"
+)
+
+// Fingerprint normalizes a query so that executions differing only in their
+// literal values share the same fingerprint. Literals and placeholders become ?,
+// lists of them become (...), keywords are lower cased and whitespace and
+// comments are removed.
+//
+//	Fingerprint("SELECT * FROM users WHERE id IN ($1, $2, 3) -- users")
+//	// select * from users where id in (...)
+func Fingerprint(query string) string {
+	tokens := scan(query, "")
+	var b strings.Builder
+	b.Grow(len(query))
+	var prev token
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		text := t.text
+		switch t.kind {
+		case tokWord:
+			text = strings.ToLower(text)
+		case tokPunct:
+			if t.text == "-" && i+1 < len(tokens) && tokens[i+1].kind == tokNumber && !isOperand(prev, i) {
+				// the sign of a negative number is part of the literal
+				continue
+			}
+		case tokString, tokNumber, tokPlaceholder:
+			text = "?"
+			if prev.kind == tokPunct && prev.text == "(" {
+				if end := valueListEnd(tokens, i); end > i {
+					b.WriteString("...")
+					i = end - 1
+					prev = tokens[i]
+					continue
+				}
+			}
+		}
+		if b.Len() > 0 && needsSpace(prev, t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(text)
+		prev = t
+	}
+	return b.String()
+}
+
+// valueListEnd returns the index of the ) closing a list of values starting
+// at i, or -1 if the tokens at i aren't such a list.
+func valueListEnd(tokens []token, i int) int {
+	for j := i; j < len(tokens); j += 2 {
+		switch tokens[j].kind {
+		case tokString, tokNumber, tokPlaceholder:
+		default:
+			return -1
+		}
+		if j+1 >= len(tokens) || tokens[j+1].kind != tokPunct {
+			return -1
+		}
+		switch tokens[j+1].text {
+		case ")":
+			return j + 1
+		case ",":
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// isOperand reports whether a - following t would be a binary minus.
+func isOperand(t token, i int) bool {
+	switch {
+	case i == 0:
+		return false
+	case t.kind == tokPunct:
+		return t.text == ")"
+	case t.kind == tokWord:
+		return !isSpacedKeyword(t.text)
+	}
+	return true
+}
+
+func needsSpace(prev token, t token) bool {
+	if prev.kind == tokPunct && (prev.text == "(" || prev.text == "." || prev.text == "::") {
+		return false
+	}
+	if t.kind == tokPunct && (t.text == ")" || t.text == "," || t.text == "." || t.text == ";" || t.text == "::") {
+		return false
+	}
+	if t.kind == tokPunct && t.text == "(" && (prev.kind == tokWord || prev.kind == tokIdent) {
+		// keep function calls such as count(*) together, but not keywords like IN
+		return isSpacedKeyword(prev.text) || t.pos > prev.pos+len(prev.text)
+	}
+	return true
+}
+
+func isSpacedKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "IN", "AS", "VALUES", "AND", "OR", "NOT", "ON", "FROM", "JOIN", "WHERE", "EXISTS", "ANY", "ALL", "USING",
+		"SELECT", "SET", "THEN", "ELSE", "WHEN", "LIMIT", "OFFSET", "BY", "RETURNING":
+		return true
+	}
+	return false
+}
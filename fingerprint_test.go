@@ -0,0 +1,31 @@
+package querypulse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		{query: "select $1", expected: "select ?"},
+		{query: "SELECT *\n  FROM users\n WHERE id = 42", expected: "select * from users where id = ?"},
+		{query: "select * from users where name = 'it''s' -- by name", expected: "select * from users where name = ?"},
+		{query: "select * from users where id in ($1, $2, $3)", expected: "select * from users where id in (...)"},
+		{query: "select * from users where id in (?)", expected: "select * from users where id in (...)"},
+		{query: "insert into t (a, b) values (1, 'x')", expected: "insert into t (a, b) values (...)"},
+		{query: "select count(*) from t where x > -1", expected: "select count(*) from t where x > ?"},
+		{query: "select a - 1 from t", expected: "select a - ? from t"},
+		{query: `select "Name", u.id::text from public.users u`, expected: `select "Name", u.id::text from public.users u`},
+		{query: "update t set v = :value where id = @id", expected: "update t set v = ? where id = ?"},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.query, func(t *testing.T) {
+			assert.Equal(t, v.expected, Fingerprint(v.query))
+		})
+	}
+}
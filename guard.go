@@ -0,0 +1,220 @@
+package querypulse
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GuardAction says what a Guard does when one of its rules matches a statement.
+type GuardAction int
+
+const (
+	// GuardAllow lets the statement through. It is the default for every rule.
+	GuardAllow GuardAction = iota
+	// GuardWarn lets the statement through and calls Guard.OnWarn.
+	GuardWarn
+	// GuardBlock returns a *GuardError without sending the statement to the database.
+	GuardBlock
+)
+
+// GuardRule names a rule that a statement broke.
+type GuardRule string
+
+const (
+	RuleUpdateWithoutWhere GuardRule = "update without where"
+	RuleDeleteWithoutWhere GuardRule = "delete without where"
+	RuleDropOrTruncate     GuardRule = "drop or truncate"
+	RuleDDL                GuardRule = "ddl outside migration"
+	RuleSelectWithoutLimit GuardRule = "select without limit"
+	RuleMultipleStatements GuardRule = "multiple statements"
+)
+
+// Guard inspects every statement before it is sent to the database and
+// blocks or warns about dangerous ones. Set it on Options.Guard.
+type Guard struct {
+	UpdateWithoutWhere GuardAction
+	DeleteWithoutWhere GuardAction
+	// DropOrTruncate applies to DROP and TRUNCATE statements, including in migrations.
+	DropOrTruncate GuardAction
+	// DDL applies to CREATE, ALTER, DROP, TRUNCATE, RENAME and COMMENT statements
+	// unless the context was marked with WithMigration.
+	DDL GuardAction
+	// SelectWithoutLimit applies to SELECT statements reading from one of
+	// LimitTables that have no LIMIT, FETCH or TOP clause.
+	SelectWithoutLimit GuardAction
+	LimitTables        []string
+	// MultipleStatements applies to queries containing more than one statement.
+	MultipleStatements GuardAction
+	// Dialect says how to read strings in statements, as backslashes only
+	// escape quotes in MySQL. Defaults to standard SQL.
+	Dialect Dialect
+
+	// OnWarn is called for every rule set to GuardWarn that a statement breaks.
+	OnWarn func(ctx context.Context, err *GuardError)
+}
+
+// GuardError is returned when a statement is blocked by a Guard.
+type GuardError struct {
+	Rule  GuardRule
+	Query string
+}
+
+func (e *GuardError) Error() string {
+	return fmt.Sprintf("querypulse: guard blocked %s: %s", e.Rule, e.Query)
+}
+
+type migrationKey struct{}
+
+// WithMigration marks the context as running migrations so the Guard DDL rule doesn't apply.
+func WithMigration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, migrationKey{}, true)
+}
+
+func isMigration(ctx context.Context) bool {
+	v, _ := ctx.Value(migrationKey{}).(bool)
+	return v
+}
+
+// check returns a *GuardError for the first blocked rule the query breaks,
+// calling OnWarn for any broken rules that only warn.
+func (g *Guard) check(ctx context.Context, query string) error {
+	stmts := statements(scan(query, g.Dialect))
+	if len(stmts) > 1 {
+		if err := g.apply(ctx, g.MultipleStatements, RuleMultipleStatements, query); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range stmts {
+		for _, rule := range g.broken(ctx, stmt) {
+			if err := g.apply(ctx, g.action(rule), rule, query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// broken returns the rules a single statement breaks.
+func (g *Guard) broken(ctx context.Context, stmt []token) []GuardRule {
+	var rules []GuardRule
+	v, i := verb(stmt)
+	switch v {
+	case "UPDATE", "DELETE":
+		if rule, ok := withoutWhere(v, stmt[i:]); ok {
+			rules = append(rules, rule)
+		}
+	case "SELECT":
+		if len(g.LimitTables) > 0 && g.unlimited(stmt) {
+			rules = append(rules, RuleSelectWithoutLimit)
+		}
+	}
+	if v == "DROP" || v == "TRUNCATE" {
+		rules = append(rules, RuleDropOrTruncate)
+	}
+	if isDDL(v) && !isMigration(ctx) {
+		rules = append(rules, RuleDDL)
+	}
+	// data modifying common table expressions, e.g. WITH x AS (DELETE ...) SELECT
+	for _, nested := range nestedWrites(stmt) {
+		v, _ := verb(nested)
+		if rule, ok := withoutWhere(v, nested); ok && !slices.Contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// withoutWhere returns the rule broken by an UPDATE or DELETE without a WHERE.
+func withoutWhere(verb string, stmt []token) (GuardRule, bool) {
+	if hasKeyword(stmt, "WHERE") {
+		return "", false
+	}
+	switch verb {
+	case "UPDATE":
+		return RuleUpdateWithoutWhere, true
+	case "DELETE":
+		return RuleDeleteWithoutWhere, true
+	}
+	return "", false
+}
+
+// unlimited reports whether a query reads one of LimitTables without a LIMIT,
+// FETCH or TOP. Each subquery and common table expression is its own query
+// and needs its own limit.
+func (g *Guard) unlimited(query []token) bool {
+	reads, limited := false, false
+	var walk func(tokens []token) bool
+	walk = func(tokens []token) bool {
+		for i := 0; i < len(tokens); i++ {
+			t := tokens[i]
+			switch {
+			case t.kind == tokPunct && t.text == "(":
+				end := closing(tokens, i)
+				inner := tokens[i+1 : end]
+				if len(inner) > 0 && (inner[0].is("SELECT") || inner[0].is("WITH")) {
+					if g.unlimited(inner) {
+						return true
+					}
+				} else if walk(inner) {
+					return true
+				}
+				i = end
+			case t.is("LIMIT") || t.is("FETCH") || t.is("TOP"):
+				limited = true
+			case (t.is("FROM") || t.is("JOIN")) && g.isLimitTable(tableAt(tokens, i+1)):
+				reads = true
+			}
+		}
+		return false
+	}
+	return walk(query) || reads && !limited
+}
+
+func (g *Guard) isLimitTable(name string) bool {
+	for _, t := range g.LimitTables {
+		if strings.EqualFold(name, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Guard) action(rule GuardRule) GuardAction {
+	switch rule {
+	case RuleUpdateWithoutWhere:
+		return g.UpdateWithoutWhere
+	case RuleDeleteWithoutWhere:
+		return g.DeleteWithoutWhere
+	case RuleDropOrTruncate:
+		return g.DropOrTruncate
+	case RuleDDL:
+		return g.DDL
+	case RuleSelectWithoutLimit:
+		return g.SelectWithoutLimit
+	case RuleMultipleStatements:
+		return g.MultipleStatements
+	}
+	return GuardAllow
+}
+
+func (g *Guard) apply(ctx context.Context, action GuardAction, rule GuardRule, query string) error {
+	switch action {
+	case GuardWarn:
+		if g.OnWarn != nil {
+			g.OnWarn(ctx, &GuardError{Rule: rule, Query: query})
+		}
+	case GuardBlock:
+		return &GuardError{Rule: rule, Query: query}
+	}
+	return nil
+}
+
+func isDDL(verb string) bool {
+	switch verb {
+	case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME", "COMMENT":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuard_rules(t *testing.T) {
+	guard := &Guard{
+		UpdateWithoutWhere: GuardBlock,
+		DeleteWithoutWhere: GuardBlock,
+		DropOrTruncate:     GuardBlock,
+		DDL:                GuardBlock,
+		SelectWithoutLimit: GuardBlock,
+		LimitTables:        []string{"events"},
+		MultipleStatements: GuardBlock,
+	}
+
+	testCases := []struct {
+		query string
+		rule  GuardRule
+	}{
+		{query: "update users set name = 'x'", rule: RuleUpdateWithoutWhere},
+		{query: "update users set name = 'where' where id = 1"},
+		{query: "update users set n = (select n from t where id = 1)", rule: RuleUpdateWithoutWhere},
+		{query: "DELETE FROM users", rule: RuleDeleteWithoutWhere},
+		{query: "delete from users where id = $1"},
+		{query: "with old as (select id from users where age > 9) delete from users", rule: RuleDeleteWithoutWhere},
+		{query: "with d as (delete from users returning id) select * from d", rule: RuleDeleteWithoutWhere},
+		{query: "with u as (update users set n = 1 where id = 2 returning id) select * from u"},
+		{query: `update users set path = 'C:\' where id = 1`},
+		{query: "drop table users", rule: RuleDropOrTruncate},
+		{query: "truncate users", rule: RuleDropOrTruncate},
+		{query: "create table users (id int)", rule: RuleDDL},
+		{query: "select * from events", rule: RuleSelectWithoutLimit},
+		{query: "select * from public.events e join users u on u.id = e.user_id", rule: RuleSelectWithoutLimit},
+		{query: "select * from events limit 10"},
+		{query: "select * from users"},
+		{query: "select * from (select * from events limit 1) e"},
+		{query: "select * from (select * from events) e limit 1", rule: RuleSelectWithoutLimit},
+		{query: "select * from users where id in (select user_id from events)", rule: RuleSelectWithoutLimit},
+		{query: "select * from events where user_id in (select id from users) limit 5"},
+		{query: "with e as (select * from events limit 5) select * from e"},
+		{query: "with e as (select * from events) select * from e limit 5", rule: RuleSelectWithoutLimit},
+		{query: "explain analyze delete from users", rule: RuleDeleteWithoutWhere},
+		{query: "explain (analyze, format json) update users set n = 1", rule: RuleUpdateWithoutWhere},
+		{query: "explain delete from users"},
+		{query: "select 1; select 2", rule: RuleMultipleStatements},
+		{query: "select 1;"},
+		{query: "select ';' -- ; delete from users"},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.query, func(t *testing.T) {
+			err := guard.check(context.Background(), v.query)
+			if v.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var guardErr *GuardError
+			assert.True(t, errors.As(err, &guardErr), "expected a GuardError, got %v", err)
+			if guardErr != nil {
+				assert.Equal(t, v.rule, guardErr.Rule)
+			}
+		})
+	}
+}
+
+func TestGuard_mysql(t *testing.T) {
+	guard := &Guard{UpdateWithoutWhere: GuardBlock, Dialect: DialectMySQL}
+
+	assert.NoError(t, guard.check(context.Background(), `update users set name = 'it\'s' where id = 1`))
+	assert.Error(t, guard.check(context.Background(), `update users set name = 'it\' where id = 1'`))
+}
+
+func TestGuard_migration(t *testing.T) {
+	guard := &Guard{DDL: GuardBlock}
+
+	assert.Error(t, guard.check(context.Background(), "alter table users add column age int"))
+	assert.NoError(t, guard.check(WithMigration(context.Background()), "alter table users add column age int"))
+}
+
+func TestGuard_warn(t *testing.T) {
+	var warned []GuardRule
+	guard := &Guard{
+		UpdateWithoutWhere: GuardWarn,
+		OnWarn: func(ctx context.Context, err *GuardError) {
+			warned = append(warned, err.Rule)
+		},
+	}
+
+	assert.NoError(t, guard.check(context.Background(), "update users set age = 1"))
+	assert.Equal(t, []GuardRule{RuleUpdateWithoutWhere}, warned)
+}
+
+func TestGuard_blocksBeforeDatabase(t *testing.T) {
+	var events []Event
+	driverName, err := Register("sqlite3", Options{
+		Guard:   &Guard{DeleteWithoutWhere: GuardBlock},
+		OnEvent: func(ctx context.Context, event Event) { events = append(events, event) },
+	})
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("create table guarded (id int)")
+	assert.NoError(t, err)
+	defer db.Exec("drop table guarded")
+	_, err = db.Exec("insert into guarded values (1)")
+	assert.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, "delete from guarded")
+	var guardErr *GuardError
+	assert.True(t, errors.As(err, &guardErr))
+
+	var n int
+	assert.NoError(t, db.QueryRow("select count(*) from guarded").Scan(&n))
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, err, events[2].Err, "blocked query should be reported")
+}
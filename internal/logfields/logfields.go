@@ -0,0 +1,54 @@
+// Package logfields holds what the qszap, qszerolog and qslogrus adapters
+// log for each query, so each adapter only binds it to its logger.
+package logfields
+
+import (
+	"context"
+	"time"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+// Level is the level a query is logged at.
+type Level int
+
+const (
+	Info Level = iota
+	Warn
+	Error
+)
+
+// Field is a key and value logged for a query.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// LogFunc writes one log entry. err is nil unless the query failed.
+type LogFunc func(ctx context.Context, level Level, msg string, fields []Field, err error)
+
+// NewOptions returns querypulse.Options that log every query with log.
+// Successful queries taking at least slowThreshold are logged at Warn, and
+// a zero slowThreshold disables it.
+func NewOptions(slowThreshold time.Duration, log LogFunc) querypulse.Options {
+	onSuccess := func(ctx context.Context, query string, args []any, duration time.Duration) {
+		if slowThreshold > 0 && duration >= slowThreshold {
+			log(ctx, Warn, "slow query", Fields(query, args, duration), nil)
+			return
+		}
+		log(ctx, Info, "query success", Fields(query, args, duration), nil)
+	}
+	onError := func(ctx context.Context, query string, args []any, duration time.Duration, err error) {
+		log(ctx, Error, "query error", Fields(query, args, duration), err)
+	}
+	return querypulse.Options{OnSuccess: onSuccess, OnError: onError}
+}
+
+// Fields returns the fields logged for a query.
+func Fields(query string, args []any, duration time.Duration) []Field {
+	return []Field{
+		{Key: "query", Value: query},
+		{Key: "args", Value: args},
+		{Key: "took_ms", Value: float64(duration) / float64(time.Millisecond)},
+	}
+}
@@ -0,0 +1,64 @@
+package logfields
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+	"github.com/stephennancekivell/querypulse/internal/logfields/logfieldstest"
+)
+
+type entry struct {
+	level  Level
+	msg    string
+	fields []Field
+	err    error
+}
+
+func TestNewOptions(t *testing.T) {
+	var entries []entry
+	options := NewOptions(time.Hour, func(ctx context.Context, level Level, msg string, fields []Field, err error) {
+		entries = append(entries, entry{level, msg, fields, err})
+	})
+	driverName, err := querypulse.Register("sqlite3", options)
+	assert.NoError(t, err)
+	db := logfieldstest.OpenDB(t, driverName)
+
+	_, err = db.Exec("select $1", 1)
+	assert.NoError(t, err)
+	_, err = db.Exec("not a valid statement")
+	assert.Error(t, err)
+	options.OnSuccess(context.Background(), "select 2", nil, 2*time.Hour)
+
+	if !assert.Len(t, entries, 3) {
+		return
+	}
+	assert.Equal(t, Info, entries[0].level)
+	assert.Equal(t, "query success", entries[0].msg)
+	assert.Equal(t, []Field{{"query", "select $1"}, {"args", []any{int64(1)}}}, entries[0].fields[:2])
+	assert.Equal(t, "took_ms", entries[0].fields[2].Key)
+	assert.NoError(t, entries[0].err)
+
+	assert.Equal(t, Error, entries[1].level)
+	assert.Equal(t, "query error", entries[1].msg)
+	assert.Equal(t, err, entries[1].err)
+
+	assert.Equal(t, Warn, entries[2].level)
+	assert.Equal(t, "slow query", entries[2].msg)
+	assert.Equal(t, Field{"took_ms", float64(2 * time.Hour / time.Millisecond)}, entries[2].fields[2])
+}
+
+func TestNewOptions_noSlowThreshold(t *testing.T) {
+	var levels []Level
+	options := NewOptions(0, func(ctx context.Context, level Level, msg string, fields []Field, err error) {
+		levels = append(levels, level)
+	})
+	options.OnSuccess(context.Background(), "select 1", nil, time.Hour)
+	options.OnError(context.Background(), "select 1", nil, time.Hour, errors.New("failed"))
+	assert.Equal(t, []Level{Info, Error}, levels)
+}
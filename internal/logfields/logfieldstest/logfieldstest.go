@@ -0,0 +1,31 @@
+// Package logfieldstest helps test the logging adapters against the sqlite
+// driver. Test binaries using it must import github.com/mattn/go-sqlite3.
+package logfieldstest
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// OpenDB opens the sqlite test database with a driver registered by an
+// adapter. It is closed when the test ends.
+func OpenDB(t *testing.T, driverName string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Record decodes the last JSON log line written to buf.
+func Record(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var r map[string]any
+	assert.NoError(t, json.Unmarshal(lines[len(lines)-1], &r))
+	return r
+}
@@ -0,0 +1,158 @@
+package querypulse
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interpolate substitutes args into the placeholders of a query so it can be
+// copied into psql or another database client to reproduce it. $1, ?, :name
+// and @name placeholders are supported, with named placeholders matched to
+// sql.NamedArg args. Values are quoted for the dialect. Placeholders without an
+// arg are left as they are.
+//
+// The result is for people to read. Never run it, use the query and args instead.
+func Interpolate(query string, args []any, dialect Dialect) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	last := 0
+	next := 0
+	for _, t := range scan(query, dialect) {
+		if t.kind != tokPlaceholder {
+			continue
+		}
+		arg, ok := placeholderArg(t.text, args, &next, dialect)
+		if !ok {
+			continue
+		}
+		b.WriteString(query[last:t.pos])
+		b.WriteString(quoteValue(arg, dialect))
+		last = t.pos + len(t.text)
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// placeholderArg finds the arg for a placeholder. next is the position of the
+// next unnamed arg for placeholders like ? that don't say which arg they are.
+func placeholderArg(placeholder string, args []any, next *int, dialect Dialect) (any, bool) {
+	switch placeholder[0] {
+	case '$':
+		n, err := strconv.Atoi(placeholder[1:])
+		if err != nil || n < 1 || n > len(args) {
+			return nil, false
+		}
+		return namedArgValue(args[n-1]), true
+	case '?':
+		if dialect == DialectPostgres {
+			// ? is the jsonb exists operator
+			return nil, false
+		}
+	case ':', '@':
+		for _, arg := range args {
+			if named, ok := arg.(sql.NamedArg); ok && named.Name == placeholder[1:] {
+				return named.Value, true
+			}
+		}
+		// a variable like MySQL's @x or a cast like Postgres' ::text
+		return nil, false
+	}
+	for *next < len(args) {
+		arg := args[*next]
+		*next++
+		if _, ok := arg.(sql.NamedArg); !ok {
+			return arg, true
+		}
+	}
+	return nil, false
+}
+
+func namedArgValue(arg any) any {
+	if named, ok := arg.(sql.NamedArg); ok {
+		return named.Value
+	}
+	return arg
+}
+
+// quoteValue renders a value as a SQL literal.
+func quoteValue(v any, dialect Dialect) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return quoteString(fmt.Sprint(v), dialect)
+		}
+		v = value
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return quoteString(v, dialect)
+	case []byte:
+		if v == nil {
+			return "NULL"
+		}
+		if dialect == DialectPostgres {
+			return `'\x` + hex.EncodeToString(v) + `'::bytea`
+		}
+		return "X'" + hex.EncodeToString(v) + "'"
+	case bool:
+		switch {
+		case dialect == DialectSQLite && v:
+			return "1"
+		case dialect == DialectSQLite:
+			return "0"
+		case v:
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		switch dialect {
+		case DialectMySQL:
+			return quoteString(v.Format("2006-01-02 15:04:05.999999"), dialect)
+		case DialectSQLite:
+			return quoteString(v.Format("2006-01-02 15:04:05.999999999-07:00"), dialect)
+		}
+		return quoteString(v.Format("2006-01-02 15:04:05.999999-07:00"), dialect)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case int, int8, int16, int32, uint, uint8, uint16, uint32, uint64, float32:
+		return fmt.Sprint(v)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return quoteValue(rv.Elem().Interface(), dialect)
+	}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = quoteValue(rv.Index(i).Interface(), dialect)
+		}
+		if dialect == DialectPostgres {
+			return "ARRAY[" + strings.Join(items, ", ") + "]"
+		}
+		return "(" + strings.Join(items, ", ") + ")"
+	}
+	return quoteString(fmt.Sprint(v), dialect)
+}
+
+func quoteString(s string, dialect Dialect) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if dialect == DialectMySQL {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + s + "'"
+}
@@ -0,0 +1,84 @@
+package querypulse
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolate(t *testing.T) {
+	at := time.Date(2023, 8, 25, 13, 24, 16, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		query    string
+		args     []any
+		dialect  Dialect
+		expected string
+	}{
+		{
+			name:     "postgres",
+			query:    "select * from users where id = $1 and name = $2 and $1 > 0",
+			args:     []any{int64(1), "it's"},
+			dialect:  DialectPostgres,
+			expected: "select * from users where id = 1 and name = 'it''s' and 1 > 0",
+		},
+		{
+			name:     "postgres types",
+			query:    "insert into t values ($1, $2, $3, $4, $5, $6)",
+			args:     []any{nil, []byte{0xde, 0xad}, true, at, 1.5, []int64{1, 2}},
+			dialect:  DialectPostgres,
+			expected: `insert into t values (NULL, '\xdead'::bytea, TRUE, '2023-08-25 13:24:16+00:00', 1.5, ARRAY[1, 2])`,
+		},
+		{
+			name:     "postgres jsonb operator",
+			query:    "select data ? 'key' from t where id = $1",
+			args:     []any{int64(1)},
+			dialect:  DialectPostgres,
+			expected: "select data ? 'key' from t where id = 1",
+		},
+		{
+			name:     "mysql",
+			query:    "select * from users where name = ? and active = ? and created < ?",
+			args:     []any{`a\'b`, false, at},
+			dialect:  DialectMySQL,
+			expected: `select * from users where name = 'a\\''b' and active = FALSE and created < '2023-08-25 13:24:16'`,
+		},
+		{
+			name:     "sqlite named",
+			query:    "select * from users where name = :name and age > @age and bytes = ?",
+			args:     []any{sql.Named("age", int64(30)), sql.Named("name", "bob"), []byte("hi")},
+			dialect:  DialectSQLite,
+			expected: "select * from users where name = 'bob' and age > 30 and bytes = X'6869'",
+		},
+		{
+			name:     "unnamed variables and casts",
+			query:    "select @x, id::text from t where id = ? and name = ?",
+			args:     []any{int64(1), "bob"},
+			dialect:  DialectMySQL,
+			expected: "select @x, id::text from t where id = 1 and name = 'bob'",
+		},
+		{
+			name:     "ignores strings and comments",
+			query:    "select '?', $1 -- $1",
+			args:     []any{int64(7)},
+			dialect:  DialectPostgres,
+			expected: "select '?', 7 -- $1",
+		},
+		{
+			name:     "missing args",
+			query:    "select $1, $2",
+			args:     []any{int64(7)},
+			dialect:  DialectPostgres,
+			expected: "select 7, $2",
+		},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.expected, Interpolate(v.query, v.args, v.dialect))
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package querypulse
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LeakDetector finds rows and prepared statements that are never closed,
+// which hold on to a connection until the pool runs out. Set it on
+// Options.Leaks.
+//
+// Leaks are reported to OnLeak when rows or statements are garbage collected
+// without being closed, and when they stay open longer than RowsThreshold or
+// StmtThreshold.
+type LeakDetector struct {
+	// RowsThreshold reports rows that are still open after this long.
+	// Zero only reports rows that are garbage collected.
+	RowsThreshold time.Duration
+	// StmtThreshold reports prepared statements that are still open after this
+	// long. Zero only reports statements that are garbage collected, but
+	// database/sql keeps statements from DB.Prepare reachable until they are
+	// closed, so those are only found with a threshold.
+	StmtThreshold time.Duration
+	// OnLeak is called with each leak found.
+	OnLeak func(leak Leak)
+
+	mu   sync.Mutex
+	open map[uint64]*tracked
+}
+
+// LeakKind is what was leaked.
+type LeakKind string
+
+const (
+	LeakRows LeakKind = "rows"
+	LeakStmt LeakKind = "statement"
+)
+
+// Leak is rows or a statement that wasn't closed.
+type Leak struct {
+	Kind   LeakKind
+	Query  string
+	ConnID uint64
+	// Age is how long it has been open.
+	Age time.Duration
+	// Collected is true when it was garbage collected without being closed.
+	Collected bool
+	// Stack is where it was created.
+	Stack string
+}
+
+func (l Leak) String() string {
+	state := "open for " + l.Age.Round(time.Millisecond).String()
+	if l.Collected {
+		state = "garbage collected without Close after " + l.Age.Round(time.Millisecond).String()
+	}
+	return fmt.Sprintf("querypulse: %s %s: %s\n%s", l.Kind, state, l.Query, l.Stack)
+}
+
+type tracked struct {
+	kind    LeakKind
+	query   string
+	conn    uint64
+	created time.Time
+	stack   []uintptr
+	timer   *time.Timer
+}
+
+// leakHandle is held by the rows or statement being tracked. Its finalizer
+// runs when they are garbage collected.
+type leakHandle struct {
+	d  *LeakDetector
+	id uint64
+}
+
+var leakIDs atomic.Uint64
+
+// Open returns the rows and statements that are open now, oldest first.
+func (d *LeakDetector) Open() []Leak {
+	return d.openSince(0)
+}
+
+func (d *LeakDetector) openSince(id uint64) []Leak {
+	now := time.Now()
+	d.mu.Lock()
+	var ids []uint64
+	for i := range d.open {
+		if i > id {
+			ids = append(ids, i)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	leaks := make([]Leak, len(ids))
+	for i, id := range ids {
+		leaks[i] = d.open[id].leak(now, false)
+	}
+	d.mu.Unlock()
+	return leaks
+}
+
+// TestingT is the part of testing.TB used by FailOnLeaks.
+type TestingT interface {
+	Helper()
+	Cleanup(func())
+	Errorf(format string, args ...any)
+}
+
+// FailOnLeaks fails the test if rows or statements created after it was
+// called are still open when the test and its cleanups registered later have
+// finished. Tests sharing a LeakDetector shouldn't run in parallel.
+func (d *LeakDetector) FailOnLeaks(t TestingT) {
+	t.Helper()
+	start := leakIDs.Load()
+	t.Cleanup(func() {
+		for _, leak := range d.openSince(start) {
+			t.Errorf("%s", leak)
+		}
+	})
+}
+
+func (t *tracked) leak(now time.Time, collected bool) Leak {
+	return Leak{
+		Kind:      t.kind,
+		Query:     t.query,
+		ConnID:    t.conn,
+		Age:       now.Sub(t.created),
+		Collected: collected,
+		Stack:     formatStack(t.stack),
+	}
+}
+
+// track starts tracking rows or a statement. It returns nil on a nil LeakDetector.
+func (d *LeakDetector) track(kind LeakKind, query string, conn uint64) *leakHandle {
+	if d == nil {
+		return nil
+	}
+	id := leakIDs.Add(1)
+	t := &tracked{kind: kind, query: query, conn: conn, created: time.Now(), stack: callers()}
+	threshold := d.RowsThreshold
+	if kind == LeakStmt {
+		threshold = d.StmtThreshold
+	}
+	if threshold > 0 {
+		t.timer = time.AfterFunc(threshold, func() { d.expired(id) })
+	}
+
+	d.mu.Lock()
+	if d.open == nil {
+		d.open = map[uint64]*tracked{}
+	}
+	d.open[id] = t
+	d.mu.Unlock()
+
+	h := &leakHandle{d: d, id: id}
+	runtime.SetFinalizer(h, (*leakHandle).collected)
+	return h
+}
+
+func (d *LeakDetector) expired(id uint64) {
+	d.mu.Lock()
+	t, ok := d.open[id]
+	d.mu.Unlock()
+	if ok {
+		d.report(t.leak(time.Now(), false))
+	}
+}
+
+func (d *LeakDetector) report(leak Leak) {
+	if d.OnLeak != nil {
+		d.OnLeak(leak)
+	}
+}
+
+// close stops tracking. It does nothing on a nil handle.
+func (h *leakHandle) close() {
+	if h == nil {
+		return
+	}
+	runtime.SetFinalizer(h, nil)
+	h.d.untrack(h.id)
+}
+
+func (h *leakHandle) collected() {
+	if t := h.d.untrack(h.id); t != nil {
+		h.d.report(t.leak(time.Now(), true))
+	}
+}
+
+func (d *LeakDetector) untrack(id uint64) *tracked {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.open[id]
+	if !ok {
+		return nil
+	}
+	delete(d.open, id)
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	return t
+}
@@ -0,0 +1,112 @@
+package querypulse
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeakDetector_threshold(t *testing.T) {
+	found := make(chan Leak, 1)
+	leaks := &LeakDetector{RowsThreshold: 10 * time.Millisecond, OnLeak: func(leak Leak) { found <- leak }}
+	db, _ := openDB(t, Options{Leaks: leaks})
+
+	rows, err := db.Query("select 1")
+	assert.NoError(t, err)
+	assert.Len(t, leaks.Open(), 1)
+
+	select {
+	case leak := <-found:
+		assert.Equal(t, LeakRows, leak.Kind)
+		assert.Equal(t, "select 1", leak.Query)
+		assert.False(t, leak.Collected)
+		assert.GreaterOrEqual(t, leak.Age, 10*time.Millisecond)
+		assert.Contains(t, leak.Stack, "leak_test.go")
+		assert.NotContains(t, leak.Stack, "database/sql")
+	case <-time.After(time.Second):
+		t.Fatal("leak wasn't reported")
+	}
+
+	assert.NoError(t, rows.Close())
+	assert.Empty(t, leaks.Open())
+}
+
+func TestLeakDetector_collected(t *testing.T) {
+	found := make(chan Leak, 1)
+	leaks := &LeakDetector{OnLeak: func(leak Leak) { found <- leak }}
+	db, _ := openDB(t, Options{Leaks: leaks})
+
+	func() {
+		rows, err := db.Query("select 1")
+		assert.NoError(t, err)
+		_ = rows
+	}()
+
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		select {
+		case leak := <-found:
+			assert.Equal(t, LeakRows, leak.Kind)
+			assert.True(t, leak.Collected)
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("leak wasn't reported")
+}
+
+type fakeT struct {
+	cleanups []func()
+	errors   []string
+}
+
+func (t *fakeT) Helper()           {}
+func (t *fakeT) Cleanup(fn func()) { t.cleanups = append(t.cleanups, fn) }
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestLeakDetector_failOnLeaks(t *testing.T) {
+	leaks := &LeakDetector{}
+	db, _ := openDB(t, Options{Leaks: leaks})
+	before, err := db.Query("select 1")
+	assert.NoError(t, err)
+
+	ft := &fakeT{}
+	leaks.FailOnLeaks(ft)
+	rows, err := db.Query("select 2")
+	assert.NoError(t, err)
+	closed, err := db.Query("select 3")
+	assert.NoError(t, err)
+	assert.NoError(t, closed.Close())
+
+	for _, fn := range ft.cleanups {
+		fn()
+	}
+	if assert.Len(t, ft.errors, 1) {
+		assert.Contains(t, ft.errors[0], "select 2")
+	}
+	assert.NoError(t, rows.Close())
+	assert.NoError(t, before.Close())
+}
+
+func TestLeakDetector_stmtThreshold(t *testing.T) {
+	found := make(chan Leak, 1)
+	leaks := &LeakDetector{StmtThreshold: 10 * time.Millisecond, OnLeak: func(leak Leak) { found <- leak }}
+	db, _ := openDB(t, Options{Leaks: leaks})
+
+	stmt, err := db.Prepare("select $1")
+	assert.NoError(t, err)
+	select {
+	case leak := <-found:
+		assert.Equal(t, LeakStmt, leak.Kind)
+		assert.Equal(t, "select $1", leak.Query)
+	case <-time.After(time.Second):
+		t.Fatal("leak wasn't reported")
+	}
+	assert.NoError(t, stmt.Close())
+	assert.Empty(t, leaks.Open())
+}
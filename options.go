@@ -2,33 +2,270 @@ package querypulse
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"time"
 )
 
 type Options struct {
 	OnSuccess func(ctx context.Context, query string, args []any, duration time.Duration)
 	OnError   func(ctx context.Context, query string, args []any, duration time.Duration, err error)
+
+	// OnEvent is called after every query with the full details of what was run.
+	OnEvent func(ctx context.Context, event Event)
+
+	// Rewrite is called before a query reaches the parent driver and returns the
+	// query and arguments to run instead, e.g. to add tenant filters or swap in
+	// shadow tables. Statements are rewritten once when they are prepared, with nil args.
+	Rewrite func(ctx context.Context, query string, args []driver.NamedValue) (string, []driver.NamedValue, error)
+
+	// Guard blocks or warns about dangerous statements before they reach the database.
+	Guard *Guard
+
+	// DefaultTimeout is applied to queries whose context has no deadline,
+	// such as those run with db.Query rather than db.QueryContext.
+	DefaultTimeout time.Duration
+	// Timeouts override DefaultTimeout for queries whose Fingerprint matches.
+	// The first match is used.
+	Timeouts []QueryTimeout
+
+	// ClassifyError replaces the default ClassifyError used to fill in Event.ErrorClass.
+	ClassifyError func(err error) ErrorClass
+
+	// OnBudgetExceeded is called once when the queries run with a context from
+	// WithBudget or WithStrictBudget go over its limits.
+	OnBudgetExceeded func(ctx context.Context, summary BudgetSummary)
+
+	// Retry runs statements outside of transactions again when they fail with a
+	// retryable error. See RetryTx for retrying whole transactions.
+	Retry *RetryPolicy
+
+	// Explain captures query plans for slow queries.
+	Explain *Explain
+
+	// Stats counts queries and their latency. See Stats.PublishExpvar.
+	Stats *Stats
+	// BackendPID fetches the server's ID for each new connection, with
+	// pg_backend_pid() for Postgres or CONNECTION_ID() for MySQL, so it can be
+	// matched with pg_stat_activity or the process list. Empty doesn't fetch it.
+	BackendPID Dialect
+	// OnPoolStats is called with the samples taken by SamplePool.
+	OnPoolStats func(ctx context.Context, stats PoolStats)
+	// Timeline records queries, transactions and connections for viewing in
+	// chrome://tracing or Perfetto.
+	Timeline *Timeline
+	// Leaks reports rows and statements that are never closed.
+	Leaks *LeakDetector
+	// Transactions reports transactions that are held open too long.
+	Transactions *TxMonitor
+	// Capture records the queries run by each test, to compare runs of a
+	// test suite with `querypulse diff`.
+	Capture *Capture
+	// Trace runs each query in a runtime/trace task and region so `go tool trace`
+	// shows the time spent in the database.
+	Trace bool
+	// ProfileLabels applies pprof labels with the query's fingerprint and
+	// operation while the driver runs it, so CPU profiles can be broken down by query.
+	ProfileLabels bool
+
+	// DriverName labels the statistics for this driver. Register sets it to the
+	// name of the wrapped driver when it's empty, otherwise it defaults to the
+	// wrapped driver's type.
+	DriverName string
+}
+
+// Event describes a single query that was run through the wrapped driver.
+type Event struct {
+	// Query is the SQL that was sent to the parent driver.
+	Query string
+	// Fingerprint is Fingerprint(Query). It is filled in before the event is
+	// reported, so callbacks don't have to compute it again.
+	Fingerprint string
+	// OriginalQuery is the SQL before Options.Rewrite was applied.
+	// It is the same as Query when nothing was rewritten.
+	OriginalQuery string
+	// Args are the query's arguments. Named args are sql.NamedArg, while
+	// OnSuccess and OnError get just their values.
+	Args     []any
+	Duration time.Duration
+	Err      error
+	// Operation says whether the query was run with Exec or Query.
+	Operation Operation
+	// ErrorClass classifies Err. It is the zero value when Err is nil.
+	ErrorClass ErrorClass
+	// Timeout is the deadline querypulse gave a query that didn't have one,
+	// from Options.DefaultTimeout or Options.Timeouts.
+	Timeout time.Duration
+	// TimedOut is true when the query failed because Timeout expired.
+	TimedOut bool
+	// OperationID links the attempts of a retried query, or the queries of a
+	// transaction retried by RetryTx.
+	OperationID uint64
+	// Attempt counts the times the operation has been run, starting at 1.
+	Attempt int
+	// ConnID identifies the connection the query was run on. IDs are unique
+	// for the life of the process.
+	ConnID uint64
+	// BackendPID is the server's ID for the connection when Options.BackendPID is set.
+	BackendPID int64
+	// ConnWait estimates how long the query waited for a connection from the
+	// pool. It is only set for queries run with a context from WithQueryStart.
+	ConnWait time.Duration
+	// TxID identifies the transaction the query was part of.
+	// It is zero outside of a transaction.
+	TxID uint64
+	// Plan is the cached plan of a slow query when Options.Explain is set.
+	// It is nil until the first plan for the query has been captured.
+	Plan *Plan
 }
 
-func (o *Options) onComplete(ctx context.Context, query string, args []driver.Value, duration time.Duration, err error) {
-	if err == nil && o.OnSuccess != nil {
-		o.OnSuccess(ctx, query, toAnyArgs(args), duration)
+func (o *Options) rewrite(ctx context.Context, query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+	if o.Rewrite == nil {
+		return query, args, nil
 	}
-	if err != nil && o.OnError != nil {
-		o.OnError(ctx, query, toAnyArgs(args), duration, err)
+	return o.Rewrite(ctx, query, args)
+}
+
+// guard checks a query against Options.Guard. Blocked queries are reported
+// through the callbacks before the error is returned.
+func (o *Options) guard(ctx context.Context, original string, query string, args []any) error {
+	if o.Guard == nil {
+		return nil
+	}
+	err := o.Guard.check(ctx, query)
+	if err != nil {
+		o.report(ctx, Event{Query: query, OriginalQuery: original, Args: args, Err: err})
 	}
+	return err
 }
 
-func (o *Options) onCompleteNamed(ctx context.Context, query string, args []driver.NamedValue, duration time.Duration, err error) {
-	if err == nil && o.OnSuccess != nil {
-		o.OnSuccess(ctx, query, argsNamed(args), duration)
+// run sends a query to the parent driver through fn, applying the Options
+// around it and reporting the outcome through the callbacks. Rows returned by fn
+// are wrapped when the context given to fn has to live until they are closed.
+func (o *Options) run(ctx context.Context, conn *connState, op Operation, original string, query string, args []driver.NamedValue, fn func(ctx context.Context) (driver.Rows, error)) (driver.Rows, error) {
+	if err := o.readOnly(ctx, original, query, argsNamed(args)); err != nil {
+		return nil, err
 	}
-	if err != nil && o.OnError != nil {
-		o.OnError(ctx, query, argsNamed(args), duration, err)
+	if err := o.budget(ctx, original, query, argsNamed(args)); err != nil {
+		return nil, err
+	}
+	operation := operationFrom(ctx)
+	var wait time.Duration
+	retry := o.Retry != nil && !conn.inTx && o.Retry.idempotent(ctx, query)
+
+	fingerprint := Fingerprint(query)
+
+	for {
+		callCtx, cancel, timeout := o.withTimeout(ctx, fingerprint)
+		callCtx = withActiveQuery(callCtx, ActiveQuery{Query: query, TxID: conn.txID})
+
+		done := o.startStats(fingerprint)
+		var rows driver.Rows
+		var err error
+		start := time.Now()
+		o.instrument(callCtx, op, fingerprint, func(ctx context.Context) {
+			rows, err = fn(ctx)
+		})
+		duration := time.Since(start)
+		done()
+		if operation.attempt == 1 {
+			wait = connWait(ctx, start)
+		}
+
+		ev := Event{
+			Query:         query,
+			Fingerprint:   fingerprint,
+			OriginalQuery: original,
+			Args:          argsNamed(args),
+			Duration:      duration,
+			Err:           err,
+			Timeout:       timeout,
+			TimedOut:      err != nil && timeout > 0 && errors.Is(callCtx.Err(), context.DeadlineExceeded),
+			Operation:     op,
+			OperationID:   operation.id,
+			Attempt:       operation.attempt,
+			ConnID:        conn.id,
+			BackendPID:    conn.backendPID,
+			ConnWait:      wait,
+			TxID:          conn.txID,
+		}
+		if err == nil && o.Explain != nil && duration >= o.Explain.threshold() {
+			ev.Plan = o.Explain.plan(query, fingerprint, args, conn.dial)
+		}
+		o.classifyEvent(&ev)
+		o.Timeline.query(conn.id, ev, start)
+		o.Transactions.statement(conn.txID, query)
+		o.spendBudget(ctx, ev)
+		o.report(ctx, ev)
+
+		if err != nil && retry && operation.attempt < o.Retry.maxAttempts() && o.Retry.shouldRetry(ev.ErrorClass) &&
+			o.Retry.wait(ctx, operation.attempt+1) {
+			cancel()
+			operation.attempt++
+			continue
+		}
+
+		if rows != nil && (timeout > 0 || o.Timeline != nil || o.Leaks != nil) {
+			opened := time.Now()
+			leak := o.Leaks.track(LeakRows, query, conn.id)
+			return wrapRows(rows, func(n int) {
+				cancel()
+				o.Timeline.rowsClosed(conn.id, query, opened, n)
+				leak.close()
+			}), err
+		}
+		cancel()
+		return rows, err
 	}
 }
 
+func (o *Options) startStats(fingerprint string) func() {
+	if o.Stats == nil {
+		return func() {}
+	}
+	return o.Stats.start(o.DriverName, fingerprint)
+}
+
+// classifyEvent fills in the ErrorClass of an event with an error.
+func (o *Options) classifyEvent(ev *Event) {
+	if ev.Err == nil || ev.ErrorClass.Category != "" {
+		return
+	}
+	ev.ErrorClass = o.classify(ev.Err)
+	if ev.TimedOut {
+		ev.ErrorClass.Category = CategoryTimeout
+	}
+}
+
+func (o *Options) report(ctx context.Context, ev Event) {
+	if ev.Fingerprint == "" {
+		ev.Fingerprint = Fingerprint(ev.Query)
+	}
+	o.classifyEvent(&ev)
+	if o.Stats != nil {
+		o.Stats.record(o.DriverName, ev)
+	}
+	o.Capture.record(ctx, ev)
+	if ev.Err == nil && o.OnSuccess != nil {
+		o.OnSuccess(ctx, ev.Query, argValues(ev.Args), ev.Duration)
+	}
+	if ev.Err != nil && o.OnError != nil {
+		o.OnError(ctx, ev.Query, argValues(ev.Args), ev.Duration, ev.Err)
+	}
+	if o.OnEvent != nil {
+		o.OnEvent(ctx, ev)
+	}
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	out := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		out[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return out
+}
+
 func toAnyArgs(args []driver.Value) []any {
 	out := make([]any, len(args))
 	for i, v := range args {
@@ -37,10 +274,30 @@ func toAnyArgs(args []driver.Value) []any {
 	return out
 }
 
+// argsNamed returns the values of args, keeping the names of named args as sql.NamedArg.
 func argsNamed(args []driver.NamedValue) []any {
 	out := make([]any, len(args))
 	for i, arg := range args {
-		out[i] = arg.Value
+		if arg.Name != "" {
+			out[i] = sql.NamedArg{Name: arg.Name, Value: arg.Value}
+		} else {
+			out[i] = arg.Value
+		}
 	}
 	return out
 }
+
+// argValues returns args with named args replaced by their values.
+func argValues(args []any) []any {
+	for i, arg := range args {
+		if _, ok := arg.(sql.NamedArg); ok {
+			out := make([]any, len(args))
+			copy(out, args[:i])
+			for j := i; j < len(args); j++ {
+				out[j] = namedArgValue(args[j])
+			}
+			return out
+		}
+	}
+	return args
+}
@@ -0,0 +1,98 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// ErrNotWrapped is returned by SamplePool for a database that wasn't opened
+// with a querypulse driver.
+var ErrNotWrapped = errors.New("querypulse: database was not opened with a querypulse driver")
+
+// PoolStats is a sample of a database's connection pool taken by SamplePool.
+type PoolStats struct {
+	sql.DBStats
+	// NewWaits and NewWaitDuration are the waits for a connection since the
+	// previous sample.
+	NewWaits        int64
+	NewWaitDuration time.Duration
+}
+
+const defaultPoolInterval = 10 * time.Second
+
+// SamplePool samples db.Stats() every interval until ctx is done, reporting
+// the samples to Options.OnPoolStats and Options.Stats of the querypulse
+// driver db was opened with. It returns ErrNotWrapped straight away if db
+// wasn't opened with a querypulse driver, otherwise the context's error.
+// interval defaults to 10 seconds when it isn't positive.
+//
+//	go querypulse.SamplePool(ctx, db, 10*time.Second)
+func SamplePool(ctx context.Context, db *sql.DB, interval time.Duration) error {
+	options, ok := driverOptions(db.Driver())
+	if !ok {
+		return ErrNotWrapped
+	}
+	if interval <= 0 {
+		interval = defaultPoolInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev sql.DBStats
+	for {
+		stats := db.Stats()
+		sample := PoolStats{
+			DBStats:         stats,
+			NewWaits:        stats.WaitCount - prev.WaitCount,
+			NewWaitDuration: stats.WaitDuration - prev.WaitDuration,
+		}
+		prev = stats
+		if options.Stats != nil {
+			options.Stats.recordPool(options.DriverName, stats)
+		}
+		if options.OnPoolStats != nil {
+			options.OnPoolStats(ctx, sample)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// driverOptions returns the Options of a querypulse driver.
+func driverOptions(d driver.Driver) (Options, bool) {
+	switch d := d.(type) {
+	case zDriver:
+		return d.options, true
+	case struct{ driver.Driver }:
+		return driverOptions(d.Driver)
+	}
+	return Options{}, false
+}
+
+type queryStartKey struct{}
+
+// WithQueryStart returns a context that remembers when the application asked
+// for a query to be run. Queries run with it report Event.ConnWait, the time
+// from then until the wrapped driver was called, which is mostly time spent
+// waiting for a connection from the pool. Use a new context for each query.
+//
+//	rows, err := db.QueryContext(querypulse.WithQueryStart(ctx), query)
+func WithQueryStart(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, time.Now())
+}
+
+// connWait estimates how long a query waited for a connection.
+func connWait(ctx context.Context, start time.Time) time.Duration {
+	queryStart, ok := ctx.Value(queryStartKey{}).(time.Time)
+	if !ok || start.Before(queryStart) {
+		return 0
+	}
+	return start.Sub(queryStart)
+}
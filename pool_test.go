@@ -0,0 +1,71 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplePool(t *testing.T) {
+	stats := NewStats()
+	ctx, cancel := context.WithCancel(ctx)
+	var samples []PoolStats
+	driverName, err := Register("sqlite3", Options{
+		Stats: stats,
+		OnPoolStats: func(_ context.Context, s PoolStats) {
+			samples = append(samples, s)
+			cancel()
+		},
+	})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(3)
+	_, err = db.Exec("select 1")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, SamplePool(ctx, db, time.Hour), context.Canceled)
+	if assert.Len(t, samples, 1) {
+		assert.Equal(t, 3, samples[0].MaxOpenConnections)
+		assert.Equal(t, 1, samples[0].Idle)
+	}
+	pool := stats.Snapshot().Drivers["sqlite3"].Pool
+	if assert.NotNil(t, pool) {
+		assert.Equal(t, 1, pool.OpenConnections)
+	}
+
+	plain, err := sql.Open("sqlite3", "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, SamplePool(ctx, plain, time.Hour), ErrNotWrapped)
+
+	// a zero interval uses the default rather than panicking
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	assert.ErrorIs(t, SamplePool(ctx, db, 0), context.Canceled)
+	assert.Len(t, samples, 2)
+}
+
+func TestConnWait(t *testing.T) {
+	var events []Event
+	driverName, err := Register("sqlite3", Options{OnEvent: func(_ context.Context, ev Event) { events = append(events, ev) }})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		tx.Rollback()
+	}()
+	_, err = db.ExecContext(WithQueryStart(ctx), "select 1")
+	assert.NoError(t, err)
+
+	if assert.Len(t, events, 1) {
+		assert.GreaterOrEqual(t, events[0].ConnWait, 20*time.Millisecond)
+	}
+}
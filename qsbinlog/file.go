@@ -0,0 +1,288 @@
+package qsbinlog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+// FileOptions configures a File.
+type FileOptions struct {
+	// MaxSize rotates the log once it has grown to this many bytes.
+	// Defaults to 64 MiB.
+	MaxSize int64
+	// MaxAge rotates the log once it has been open this long. Zero doesn't
+	// rotate on age.
+	MaxAge time.Duration
+	// MaxFiles removes the oldest rotated logs when there are more than this.
+	// Zero keeps them all.
+	MaxFiles int
+	// FlushInterval is how often buffered events are written to the file in
+	// the background. Defaults to a second.
+	FlushInterval time.Duration
+	// OmitArgs leaves the args out of the log.
+	OmitArgs bool
+	// OnError is called when the log can't be written. Later events are
+	// dropped until File.Rotate succeeds. See also File.Err.
+	OnError func(err error)
+}
+
+const (
+	defaultMaxSize       = 64 << 20
+	defaultFlushInterval = time.Second
+	rotatedTimeFormat    = "20060102T150405.000000000"
+)
+
+// File is a sink that writes events to a binary log, rotating it as it grows.
+// Rotated logs are renamed to the path followed by the time they were
+// rotated, such as "queries.qpl.20240102T150405.000000000", and each one can
+// be read on its own.
+//
+//	f, err := qsbinlog.OpenFile("queries.qpl", qsbinlog.FileOptions{MaxFiles: 10})
+//	...
+//	defer f.Close()
+//	driverName, err := querypulse.Register("postgres", querypulse.Options{OnEvent: f.OnEvent})
+type File struct {
+	path string
+	opts FileOptions
+
+	mu     sync.Mutex
+	closed bool
+	f      *os.File
+	w      *bufio.Writer
+	enc    *Encoder
+	size   int64
+	opened time.Time
+	err    error
+	now    func() time.Time
+	// stop ends the background flushing when the File is closed.
+	stop chan struct{}
+}
+
+// OpenFile opens a binary log at path. A log already at path is rotated
+// first, as each log holds its own dictionary.
+func OpenFile(path string, opts FileOptions) (*File, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultMaxSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	f := &File{path: path, opts: opts, now: time.Now, stop: make(chan struct{})}
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+		if err := f.rename(); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	go f.flushEvery(opts.FlushInterval)
+	return f, nil
+}
+
+// flushEvery flushes the buffered events each interval until the File is closed.
+func (f *File) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			if !f.closed && f.f != nil && f.err == nil && f.w.Buffered() > 0 {
+				f.setErr(f.w.Flush())
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	f.f, f.size = file, 0
+	f.w = bufio.NewWriterSize(&countingWriter{w: file, n: &f.size}, 64*1024)
+	f.enc = NewEncoder(f.w, f.opts.OmitArgs)
+	f.opened = f.now()
+	return nil
+}
+
+// OnEvent writes an event to the log. It is a querypulse.Options.OnEvent.
+func (f *File) OnEvent(ctx context.Context, ev querypulse.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed || f.err != nil {
+		return
+	}
+
+	now := f.now()
+	if f.size+int64(f.w.Buffered()) >= f.opts.MaxSize || f.opts.MaxAge > 0 && now.Sub(f.opened) >= f.opts.MaxAge {
+		if err := f.rotate(); err != nil {
+			f.setErr(err)
+			return
+		}
+	}
+	f.setErr(f.enc.Encode(now, ev))
+}
+
+func (f *File) setErr(err error) {
+	if err == nil {
+		return
+	}
+	f.err = err
+	if f.opts.OnError != nil {
+		f.opts.OnError(err)
+	}
+}
+
+// Err returns the error that stopped events being written, if any.
+func (f *File) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// Flush writes buffered events to the file.
+func (f *File) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.f == nil {
+		return f.err
+	}
+	return f.w.Flush()
+}
+
+// Rotate closes the log and starts a new one.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if err := f.rotate(); err != nil {
+		f.setErr(err)
+		return err
+	}
+	f.err = nil
+	return nil
+}
+
+func (f *File) rotate() error {
+	if f.f != nil {
+		err := f.w.Flush()
+		if cerr := f.f.Close(); err == nil {
+			err = cerr
+		}
+		f.f = nil
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(f.path); err == nil {
+		if err := f.rename(); err != nil {
+			return err
+		}
+	}
+	return f.open()
+}
+
+// rename moves the current log aside and removes the oldest beyond MaxFiles.
+func (f *File) rename() error {
+	if err := os.Rename(f.path, f.path+"."+f.now().UTC().Format(rotatedTimeFormat)); err != nil {
+		return err
+	}
+	if f.opts.MaxFiles <= 0 {
+		return nil
+	}
+	rotated, err := rotatedFiles(f.path)
+	if err != nil {
+		return err
+	}
+	for len(rotated) > f.opts.MaxFiles {
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// Close flushes and closes the log.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	close(f.stop)
+	if f.f == nil {
+		return nil
+	}
+	err := f.w.Flush()
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	f.f = nil
+	return err
+}
+
+// Files returns the logs written by a File at path, oldest first, ending
+// with path itself if it exists.
+func Files(path string) ([]string, error) {
+	files, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+func rotatedFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(globEscape(path) + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, m := range matches {
+		if _, err := time.Parse(rotatedTimeFormat, strings.TrimPrefix(m, path+".")); err == nil {
+			files = append(files, m)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func globEscape(path string) string {
+	r := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`)
+	dir, file := filepath.Split(path)
+	return filepath.Join(dir, r.Replace(file))
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	*c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,410 @@
+// Package qsbinlog writes querypulse events to a compact binary log and reads
+// them back.
+//
+// A log starts with a header holding the magic "QPLOG", a version and the
+// time the log was started. It is followed by records, each starting with a
+// type byte. Fingerprint records add a fingerprint and the first query seen
+// with it to a dictionary. Event records refer to the dictionary by number,
+// and only hold the query when it differs from the one in the dictionary, so
+// parameterized queries take a few bytes. Numbers are varints, times are
+// deltas from the previous event and args are optional.
+package qsbinlog
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+const (
+	magic   = "QPLOG"
+	version = 1
+)
+
+const (
+	recordFingerprint = 1
+	recordEvent       = 2
+)
+
+const (
+	flagErr = 1 << iota
+	flagQuery
+	flagArgs
+	flagExec
+)
+
+const (
+	argNil = iota
+	argInt
+	argFloat
+	argFalse
+	argTrue
+	argString
+	argBytes
+	argTime
+	argNamed
+	argOther
+)
+
+// ErrFormat is returned when reading something that isn't a querypulse binary log.
+var ErrFormat = errors.New("qsbinlog: not a querypulse binary log")
+
+// Record is an event read from a log.
+type Record struct {
+	// Time is when the event finished, in UTC.
+	Time        time.Time
+	Query       string
+	Fingerprint string
+	// Args are nil when the log was written without args.
+	Args          []any
+	Duration      time.Duration
+	Operation     querypulse.Operation
+	Error         string
+	ErrorCategory querypulse.Category
+	ConnID        uint64
+	TxID          uint64
+	Attempt       int
+}
+
+// Encoder writes events in the binary format.
+type Encoder struct {
+	w        io.Writer
+	omitArgs bool
+	last     time.Time
+	dict     map[string]fingerprintEntry
+	maxDict  int
+	buf      []byte
+	header   bool
+}
+
+type fingerprintEntry struct {
+	id    uint64
+	query string
+}
+
+// maxDictionary stops the dictionary growing without limit when queries have
+// their values inlined rather than passed as args. Later fingerprints are
+// written with each event.
+const maxDictionary = 100000
+
+// NewEncoder returns an Encoder writing to w. The header is written with the
+// first event. When omitArgs is set args are left out of the log.
+func NewEncoder(w io.Writer, omitArgs bool) *Encoder {
+	return &Encoder{w: w, omitArgs: omitArgs, dict: map[string]fingerprintEntry{}, maxDict: maxDictionary}
+}
+
+// Encode writes an event that finished at t.
+func (e *Encoder) Encode(t time.Time, ev querypulse.Event) error {
+	b := e.buf[:0]
+	if !e.header {
+		e.last = t
+		b = append(b, magic...)
+		b = append(b, version)
+		b = binary.AppendVarint(b, t.UnixNano())
+		e.header = true
+	}
+
+	fingerprint := ev.Fingerprint
+	if fingerprint == "" {
+		fingerprint = querypulse.Fingerprint(ev.Query)
+	}
+	entry, ok := e.dict[fingerprint]
+	if !ok && len(e.dict) < e.maxDict {
+		entry = fingerprintEntry{id: uint64(len(e.dict) + 1), query: ev.Query}
+		e.dict[fingerprint] = entry
+		b = append(b, recordFingerprint)
+		b = binary.AppendUvarint(b, entry.id)
+		b = appendString(b, fingerprint)
+		b = appendString(b, ev.Query)
+		ok = true
+	}
+
+	var flags uint64
+	if ev.Err != nil {
+		flags |= flagErr
+	}
+	if !ok || entry.query != ev.Query {
+		flags |= flagQuery
+	}
+	if !e.omitArgs && ev.Args != nil {
+		flags |= flagArgs
+	}
+	if ev.Operation == querypulse.OpExec {
+		flags |= flagExec
+	}
+
+	b = append(b, recordEvent)
+	b = binary.AppendUvarint(b, flags)
+	b = binary.AppendVarint(b, int64(t.Sub(e.last)))
+	e.last = t
+	b = binary.AppendUvarint(b, entry.id)
+	if flags&flagQuery != 0 {
+		b = appendString(b, ev.Query)
+	}
+	b = binary.AppendUvarint(b, uint64(ev.Duration))
+	b = binary.AppendUvarint(b, ev.ConnID)
+	b = binary.AppendUvarint(b, ev.TxID)
+	b = binary.AppendUvarint(b, uint64(ev.Attempt))
+	if flags&flagErr != 0 {
+		b = appendString(b, ev.Err.Error())
+		b = appendString(b, string(ev.ErrorClass.Category))
+	}
+	if flags&flagArgs != 0 {
+		b = binary.AppendUvarint(b, uint64(len(ev.Args)))
+		for _, arg := range ev.Args {
+			b = appendArg(b, arg)
+		}
+	}
+
+	e.buf = b
+	_, err := e.w.Write(b)
+	return err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendArg(b []byte, arg any) []byte {
+	switch v := arg.(type) {
+	case nil:
+		return append(b, argNil)
+	case int64:
+		return binary.AppendVarint(append(b, argInt), v)
+	case int:
+		return binary.AppendVarint(append(b, argInt), int64(v))
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(b, argFloat), math.Float64bits(v))
+	case bool:
+		if v {
+			return append(b, argTrue)
+		}
+		return append(b, argFalse)
+	case string:
+		return appendString(append(b, argString), v)
+	case []byte:
+		return appendString(append(b, argBytes), string(v))
+	case time.Time:
+		return binary.AppendVarint(append(b, argTime), v.UnixNano())
+	case sql.NamedArg:
+		b = appendString(append(b, argNamed), v.Name)
+		return appendArg(b, v.Value)
+	}
+	return appendString(append(b, argOther), fmt.Sprint(arg))
+}
+
+// Reader reads the events of a log.
+type Reader struct {
+	r            *bufio.Reader
+	last         time.Time
+	fingerprints map[uint64]fingerprintEntry
+	names        map[uint64]string
+}
+
+// NewReader reads the header of a log and returns a Reader for its events.
+// It returns ErrFormat if r doesn't hold a querypulse binary log.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrFormat
+		}
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrFormat
+	}
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("qsbinlog: unsupported version %d", header[len(magic)])
+	}
+	started, err := binary.ReadVarint(br)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	return &Reader{
+		r:            br,
+		last:         time.Unix(0, started).UTC(),
+		fingerprints: map[uint64]fingerprintEntry{},
+		names:        map[uint64]string{},
+	}, nil
+}
+
+// IsBinaryLog reports whether data starts like a querypulse binary log.
+func IsBinaryLog(data []byte) bool {
+	return len(data) >= len(magic) && string(data[:len(magic)]) == magic
+}
+
+// Next returns the next event. It returns io.EOF at the end of the log and
+// io.ErrUnexpectedEOF when the log ends part way through an event, such as
+// when the writer crashed.
+func (r *Reader) Next() (Record, error) {
+	for {
+		kind, err := r.r.ReadByte()
+		if err != nil {
+			return Record{}, err
+		}
+		switch kind {
+		case recordFingerprint:
+			id, err := binary.ReadUvarint(r.r)
+			if err != nil {
+				return Record{}, unexpected(err)
+			}
+			fingerprint, err := r.readString()
+			if err != nil {
+				return Record{}, err
+			}
+			query, err := r.readString()
+			if err != nil {
+				return Record{}, err
+			}
+			r.fingerprints[id] = fingerprintEntry{query: query}
+			r.names[id] = fingerprint
+		case recordEvent:
+			return r.readEvent()
+		default:
+			return Record{}, fmt.Errorf("qsbinlog: unknown record type %d", kind)
+		}
+	}
+}
+
+func (r *Reader) readEvent() (Record, error) {
+	var rec Record
+	flags, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return rec, unexpected(err)
+	}
+	delta, err := binary.ReadVarint(r.r)
+	if err != nil {
+		return rec, unexpected(err)
+	}
+	r.last = r.last.Add(time.Duration(delta))
+	rec.Time = r.last
+
+	id, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return rec, unexpected(err)
+	}
+	rec.Query, rec.Fingerprint = r.fingerprints[id].query, r.names[id]
+	if flags&flagQuery != 0 {
+		if rec.Query, err = r.readString(); err != nil {
+			return rec, err
+		}
+		if id == 0 {
+			rec.Fingerprint = querypulse.Fingerprint(rec.Query)
+		}
+	}
+
+	var nums [4]uint64
+	for i := range nums {
+		if nums[i], err = binary.ReadUvarint(r.r); err != nil {
+			return rec, unexpected(err)
+		}
+	}
+	rec.Duration, rec.ConnID, rec.TxID, rec.Attempt = time.Duration(nums[0]), nums[1], nums[2], int(nums[3])
+	rec.Operation = querypulse.OpQuery
+	if flags&flagExec != 0 {
+		rec.Operation = querypulse.OpExec
+	}
+
+	if flags&flagErr != 0 {
+		if rec.Error, err = r.readString(); err != nil {
+			return rec, err
+		}
+		category, err := r.readString()
+		if err != nil {
+			return rec, err
+		}
+		rec.ErrorCategory = querypulse.Category(category)
+	}
+	if flags&flagArgs != 0 {
+		n, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return rec, unexpected(err)
+		}
+		rec.Args = make([]any, 0, min(n, 1024))
+		for i := uint64(0); i < n; i++ {
+			arg, err := r.readArg()
+			if err != nil {
+				return rec, err
+			}
+			rec.Args = append(rec.Args, arg)
+		}
+	}
+	return rec, nil
+}
+
+// maxString is the longest string a Reader accepts, so a corrupt length
+// can't make it allocate without limit.
+const maxString = 64 << 20
+
+func (r *Reader) readString() (string, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return "", unexpected(err)
+	}
+	if n > maxString {
+		return "", fmt.Errorf("qsbinlog: string of %d bytes is too long", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return "", unexpected(err)
+	}
+	return string(b), nil
+}
+
+func (r *Reader) readArg() (any, error) {
+	kind, err := r.r.ReadByte()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	switch kind {
+	case argNil:
+		return nil, nil
+	case argInt:
+		v, err := binary.ReadVarint(r.r)
+		return v, unexpected(err)
+	case argFloat:
+		var b [8]byte
+		if _, err := io.ReadFull(r.r, b[:]); err != nil {
+			return nil, unexpected(err)
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[:])), nil
+	case argFalse:
+		return false, nil
+	case argTrue:
+		return true, nil
+	case argString, argOther:
+		return r.readString()
+	case argBytes:
+		s, err := r.readString()
+		return []byte(s), err
+	case argTime:
+		v, err := binary.ReadVarint(r.r)
+		return time.Unix(0, v).UTC(), unexpected(err)
+	case argNamed:
+		name, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.readArg()
+		return sql.NamedArg{Name: name, Value: value}, err
+	}
+	return nil, fmt.Errorf("qsbinlog: unknown arg type %d", kind)
+}
+
+// unexpected turns an io.EOF part way through a record into io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
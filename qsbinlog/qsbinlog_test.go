@@ -0,0 +1,241 @@
+package qsbinlog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+func readAll(t *testing.T, r io.Reader) []Record {
+	reader, err := NewReader(r)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	var records []Record
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return records
+		}
+		if !assert.NoError(t, err) {
+			return records
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, false)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	events := []querypulse.Event{
+		{Query: "select * from users where id = $1", Args: []any{int64(1)}, Duration: time.Millisecond, Operation: querypulse.OpQuery, ConnID: 1, Attempt: 1},
+		{Query: "select * from users where id = $1", Args: []any{int64(2)}, Duration: 2 * time.Millisecond, Operation: querypulse.OpQuery, ConnID: 2, Attempt: 1},
+		{Query: "select * from users where id = 3", Duration: time.Second, Operation: querypulse.OpQuery, ConnID: 2, Attempt: 1},
+		{
+			Query:      "insert into t values ($1, $2, $3, $4, $5, $6, $7)",
+			Args:       []any{nil, 1.5, true, "x", []byte("y"), at, sql.Named("n", int64(-7))},
+			Err:        errors.New("duplicate key"),
+			ErrorClass: querypulse.ErrorClass{Category: querypulse.CategoryUniqueViolation},
+			Operation:  querypulse.OpExec,
+			ConnID:     1,
+			TxID:       9,
+			Attempt:    2,
+		},
+	}
+	for i, ev := range events {
+		assert.NoError(t, enc.Encode(start.Add(time.Duration(i)*time.Millisecond), ev))
+	}
+
+	records := readAll(t, &buf)
+	if !assert.Len(t, records, 4) {
+		return
+	}
+	assert.Equal(t, Record{
+		Time: start, Query: "select * from users where id = $1", Fingerprint: "select * from users where id = ?",
+		Args: []any{int64(1)}, Duration: time.Millisecond, Operation: querypulse.OpQuery, ConnID: 1, Attempt: 1,
+	}, records[0])
+	assert.Equal(t, []any{int64(2)}, records[1].Args)
+	assert.Equal(t, start.Add(time.Millisecond), records[1].Time)
+
+	// same fingerprint, different text
+	assert.Equal(t, "select * from users where id = 3", records[2].Query)
+	assert.Equal(t, "select * from users where id = ?", records[2].Fingerprint)
+	assert.Nil(t, records[2].Args)
+
+	assert.Equal(t, Record{
+		Time: start.Add(3 * time.Millisecond), Query: events[3].Query, Fingerprint: "insert into t values (...)",
+		Args:      []any{nil, 1.5, true, "x", []byte("y"), at, sql.Named("n", int64(-7))},
+		Operation: querypulse.OpExec, Error: "duplicate key", ErrorCategory: querypulse.CategoryUniqueViolation,
+		ConnID: 1, TxID: 9, Attempt: 2,
+	}, records[3])
+}
+
+func TestEncoder_dictionary(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, true)
+	query := "select id, name, email, created_at from users where org_id = $1 and deleted_at is null"
+	assert.NoError(t, enc.Encode(time.Now(), querypulse.Event{Query: query, Args: []any{int64(1)}}))
+	first := buf.Len()
+	assert.NoError(t, enc.Encode(time.Now(), querypulse.Event{Query: query, Args: []any{int64(2)}}))
+	assert.Less(t, buf.Len()-first, 20, "the second event refers to the dictionary")
+
+	records := readAll(t, &buf)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, query, records[1].Query)
+		assert.Nil(t, records[1].Args, "args are omitted")
+	}
+}
+
+func TestEncoder_dictionaryFull(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, false)
+	enc.maxDict = 1
+	assert.NoError(t, enc.Encode(time.Now(), querypulse.Event{Query: "select a"}))
+	assert.NoError(t, enc.Encode(time.Now(), querypulse.Event{Query: "select b from t where x = 1"}))
+
+	records := readAll(t, &buf)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "select b from t where x = 1", records[1].Query)
+		assert.Equal(t, "select b from t where x = ?", records[1].Fingerprint)
+	}
+}
+
+func TestReader_errors(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte(`{"query":"select 1"}`)))
+	assert.Equal(t, ErrFormat, err)
+	_, err = NewReader(bytes.NewReader(nil))
+	assert.Equal(t, ErrFormat, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, NewEncoder(&buf, false).Encode(time.Now(), querypulse.Event{Query: "select 1", Args: []any{"abc"}}))
+	assert.True(t, IsBinaryLog(buf.Bytes()))
+
+	reader, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	assert.NoError(t, err)
+	_, err = reader.Next()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// a fingerprint claiming to be a terabyte long
+	corrupt := append([]byte(magic), version, 0, recordFingerprint, 1)
+	corrupt = binary.AppendUvarint(corrupt, 1<<40)
+	reader, err = NewReader(bytes.NewReader(corrupt))
+	assert.NoError(t, err)
+	_, err = reader.Next()
+	assert.EqualError(t, err, "qsbinlog: string of 1099511627776 bytes is too long")
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.qpl")
+	f, err := OpenFile(path, FileOptions{MaxSize: 200, MaxFiles: 2})
+	assert.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+
+	for i := 0; i < 20; i++ {
+		f.OnEvent(context.Background(), querypulse.Event{Query: "select * from users where id = $1", Args: []any{int64(i)}})
+	}
+	assert.NoError(t, f.Close())
+	assert.NoError(t, f.Err())
+	assert.Equal(t, os.ErrClosed, f.Close())
+
+	files, err := Files(path)
+	assert.NoError(t, err)
+	if !assert.Len(t, files, 3, "two rotated logs are kept") {
+		return
+	}
+	assert.Equal(t, path, files[2])
+
+	var ids []int64
+	for _, name := range files {
+		file, err := os.Open(name)
+		assert.NoError(t, err)
+		for _, rec := range readAll(t, file) {
+			ids = append(ids, rec.Args[0].(int64))
+		}
+		file.Close()
+	}
+	assert.NotEmpty(t, ids)
+	assert.Equal(t, int64(19), ids[len(ids)-1])
+	for i := 1; i < len(ids); i++ {
+		assert.Equal(t, ids[i-1]+1, ids[i], "the kept logs are in order")
+	}
+}
+
+func TestFile_existing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.qpl")
+	for i := 0; i < 2; i++ {
+		f, err := OpenFile(path, FileOptions{})
+		assert.NoError(t, err)
+		f.OnEvent(context.Background(), querypulse.Event{Query: "select 1"})
+		assert.NoError(t, f.Close())
+	}
+
+	files, err := Files(path)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2, "the old log is rotated rather than appended to")
+}
+
+func TestFile_flushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.qpl")
+	f, err := OpenFile(path, FileOptions{FlushInterval: time.Millisecond})
+	assert.NoError(t, err)
+	defer f.Close()
+
+	f.OnEvent(context.Background(), querypulse.Event{Query: "select 1"})
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(path)
+		return err == nil && info.Size() > 0
+	}, time.Second, time.Millisecond, "events are flushed without waiting for the next one")
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	assert.Len(t, readAll(t, file), 1)
+}
+
+func TestFile_driver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.qpl")
+	f, err := OpenFile(path, FileOptions{})
+	assert.NoError(t, err)
+
+	driverName, err := querypulse.Register("sqlite3", querypulse.Options{OnEvent: f.OnEvent})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("select $1", 1)
+	assert.NoError(t, err)
+	_, err = db.Exec("select * from missing")
+	assert.Error(t, err)
+	assert.NoError(t, f.Close())
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	records := readAll(t, file)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "select $1", records[0].Query)
+		assert.Equal(t, []any{int64(1)}, records[0].Args)
+		assert.Equal(t, querypulse.OpExec, records[0].Operation)
+		assert.NotZero(t, records[0].ConnID)
+		assert.Contains(t, records[1].Error, "no such table")
+	}
+}
@@ -0,0 +1,192 @@
+// Package qshttp summarizes the queries run for each HTTP request.
+package qshttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+// Options configures Middleware. The zero value logs a summary of every
+// request and adds a Server-Timing header.
+type Options struct {
+	// Logger logs the summary of each request. Defaults to slog.Default.
+	Logger *slog.Logger
+	// OmitServerTiming leaves out the Server-Timing header.
+	OmitServerTiming bool
+
+	// MaxQueries and MaxDBTime are the budget of each request, see
+	// querypulse.WithBudget. Zero leaves a limit off.
+	MaxQueries int
+	MaxDBTime  time.Duration
+	// Strict rejects queries once the budget is used up, see querypulse.WithStrictBudget.
+	Strict bool
+
+	// NPlusOneThreshold is how many times one fingerprint has to run in a
+	// request for it to be reported as an N+1 query. Defaults to 5.
+	NPlusOneThreshold int
+}
+
+// Middleware opens a querypulse budget for each request. The queries run with
+// the request's context through a querypulse driver are counted, a
+// Server-Timing header with the database time is added to the response, and a
+// summary is logged when the request finishes. The summary is logged at Warn
+// when the budget was exceeded or N+1 queries were found.
+//
+// The Server-Timing header is added when the response headers are written, so
+// it only counts the queries run before then.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	log := opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	threshold := opts.NPlusOneThreshold
+	if threshold <= 0 {
+		threshold = 5
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var ctx context.Context
+			if opts.Strict {
+				ctx = querypulse.WithStrictBudget(r.Context(), opts.MaxQueries, opts.MaxDBTime)
+			} else {
+				ctx = querypulse.WithBudget(r.Context(), opts.MaxQueries, opts.MaxDBTime)
+			}
+			budget, _ := querypulse.BudgetFromContext(ctx)
+
+			if opts.OmitServerTiming {
+				next.ServeHTTP(w, r.WithContext(ctx))
+			} else {
+				rw := &responseWriter{ResponseWriter: w, budget: budget}
+				next.ServeHTTP(rw, r.WithContext(ctx))
+				rw.addServerTiming()
+			}
+
+			summary := budget.Summary()
+			nPlusOne := NPlusOne(summary, threshold)
+			level := slog.LevelInfo
+			if summary.Exceeded || len(nPlusOne) > 0 {
+				level = slog.LevelWarn
+			}
+			if !log.Enabled(ctx, level) {
+				return
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("queries", summary.Queries),
+				slog.Float64("db_ms", ms(summary.DBTime)),
+			}
+			if summary.Slowest != "" {
+				attrs = append(attrs,
+					slog.String("slowest_fingerprint", querypulse.Fingerprint(summary.Slowest)),
+					slog.Float64("slowest_ms", ms(summary.SlowestDuration)))
+			}
+			if summary.Exceeded {
+				attrs = append(attrs, slog.Bool("budget_exceeded", true))
+			}
+			if summary.Rejected > 0 {
+				attrs = append(attrs, slog.Int("rejected", summary.Rejected))
+			}
+			if len(nPlusOne) > 0 {
+				patterns := make([]slog.Attr, len(nPlusOne))
+				for i, p := range nPlusOne {
+					patterns[i] = slog.Int(p.Fingerprint, p.Count)
+				}
+				attrs = append(attrs, slog.Attr{Key: "n_plus_one", Value: slog.GroupValue(patterns...)})
+			}
+			log.LogAttrs(ctx, level, "request queries", attrs...)
+		})
+	}
+}
+
+// Pattern is a fingerprint that was run many times in one request.
+type Pattern struct {
+	Fingerprint string
+	Count       int
+}
+
+// NPlusOne returns the fingerprints of a summary that ran at least threshold
+// times, most frequent first.
+func NPlusOne(summary querypulse.BudgetSummary, threshold int) []Pattern {
+	var patterns []Pattern
+	for fingerprint, n := range summary.Fingerprints {
+		if n >= threshold {
+			patterns = append(patterns, Pattern{Fingerprint: fingerprint, Count: n})
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Count != patterns[j].Count {
+			return patterns[i].Count > patterns[j].Count
+		}
+		return patterns[i].Fingerprint < patterns[j].Fingerprint
+	})
+	return patterns
+}
+
+// ServerTiming formats a summary as a Server-Timing header value.
+func ServerTiming(summary querypulse.BudgetSummary) string {
+	return fmt.Sprintf("db;dur=%s;desc=\"%d queries\"", strconv.FormatFloat(ms(summary.DBTime), 'f', 1, 64), summary.Queries)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// responseWriter adds the Server-Timing header before the headers are written.
+type responseWriter struct {
+	http.ResponseWriter
+	budget      *querypulse.Budget
+	wroteHeader bool
+}
+
+// addServerTiming adds the header unless the headers were already written.
+func (w *responseWriter) addServerTiming() {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Add("Server-Timing", ServerTiming(w.budget.Summary()))
+	}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.addServerTiming()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack lets handlers take over the connection, such as for websockets.
+// Hijacked responses don't get the Server-Timing header.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the original ResponseWriter.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,104 @@
+package qshttp
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+func TestMiddleware(t *testing.T) {
+	driverName, err := querypulse.Register("sqlite3", querypulse.Options{})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	handler := Middleware(Options{Logger: log, NPlusOneThreshold: 3})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := db.ExecContext(r.Context(), "select name from sqlite_master")
+		assert.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			_, err := db.ExecContext(r.Context(), "select $1", i)
+			assert.NoError(t, err)
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/users", nil))
+
+	assert.Regexp(t, `^db;dur=\d+\.\d;desc="4 queries"$`, rec.Header().Get("Server-Timing"))
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "request queries", record["msg"])
+	assert.Equal(t, "/users", record["path"])
+	assert.Equal(t, 4.0, record["queries"])
+	assert.Contains(t, record, "db_ms")
+	assert.Contains(t, record, "slowest_fingerprint")
+	assert.Equal(t, map[string]any{"select ?": 3.0}, record["n_plus_one"])
+}
+
+func TestMiddleware_strict(t *testing.T) {
+	driverName, err := querypulse.Register("sqlite3", querypulse.Options{})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	handler := Middleware(Options{Logger: log, MaxQueries: 1, Strict: true, OmitServerTiming: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := db.ExecContext(r.Context(), "select 1")
+		assert.NoError(t, err)
+		_, err = db.ExecContext(r.Context(), "select 2")
+		assert.Error(t, err)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	assert.Empty(t, rec.Header().Get("Server-Timing"))
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, true, record["budget_exceeded"])
+	assert.Equal(t, 1.0, record["rejected"])
+}
+
+func TestMiddleware_hijack(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	server := httptest.NewServer(Middleware(Options{Logger: log})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !assert.True(t, ok, "websocket libraries need an http.Hijacker") {
+			return
+		}
+		conn, rw, err := hijacker.Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "hijacked", string(body))
+	assert.Empty(t, resp.Header.Get("Server-Timing"))
+}
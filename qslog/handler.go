@@ -0,0 +1,43 @@
+package qslog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+// NewHandler wraps a slog.Handler so that records logged with a context that
+// querypulse passed to the wrapped driver, such as from a driver's notice
+// handler or while it reads rows, get the in-flight query's fingerprint and
+// transaction ID as "query_fingerprint" and "tx_id" attributes.
+func NewHandler(h slog.Handler) slog.Handler {
+	return &handler{parent: h}
+}
+
+type handler struct {
+	parent slog.Handler
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.parent.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if q, ok := querypulse.QueryFromContext(ctx); ok {
+		r = r.Clone()
+		r.AddAttrs(slog.String("query_fingerprint", q.Fingerprint()))
+		if q.TxID != 0 {
+			r.AddAttrs(slog.Uint64("tx_id", q.TxID))
+		}
+	}
+	return h.parent.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{parent: h.parent.WithAttrs(attrs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{parent: h.parent.WithGroup(name)}
+}
@@ -0,0 +1,63 @@
+package qslog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+// loggingConn is a driver.Conn that logs from inside ExecContext, like a driver's notice handler.
+type loggingConn struct {
+	log *slog.Logger
+}
+
+func (c *loggingConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *loggingConn) Close() error                              { return nil }
+func (c *loggingConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *loggingConn) Commit() error                             { return nil }
+func (c *loggingConn) Rollback() error                           { return nil }
+
+func (c *loggingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.log.InfoContext(ctx, "notice")
+	return driver.RowsAffected(0), nil
+}
+
+type loggingConnector struct {
+	conn *loggingConn
+}
+
+func (c loggingConnector) Connect(ctx context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c loggingConnector) Driver() driver.Driver                            { return nil }
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil)))
+
+	db := sql.OpenDB(querypulse.WrapConnector(loggingConnector{conn: &loggingConn{log: log}}, querypulse.Options{}))
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	assert.NoError(t, err)
+	_, err = tx.ExecContext(context.Background(), "update users set age = $1", 30)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "notice", record["msg"])
+	assert.Equal(t, "update users set age = ?", record["query_fingerprint"])
+	assert.NotZero(t, record["tx_id"])
+
+	buf.Reset()
+	log.Info("outside a query")
+	record = nil
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.NotContains(t, record, "query_fingerprint")
+}
@@ -3,23 +3,162 @@ package qslog
 import (
 	"context"
 	"time"
+	"unicode/utf8"
 
 	"log/slog"
 
 	"github.com/stephennancekivell/querypulse"
 )
 
+// Options configures the logs written by a driver registered with RegisterWithOptions.
+// The zero value logs every query at Info and errors at Error.
+type Options struct {
+	// SlowThreshold logs successful queries taking at least this long at Warn.
+	// Zero disables it.
+	SlowThreshold time.Duration
+
+	// Keys names the attributes. Empty keys use the defaults.
+	Keys Keys
+	// DurationUnit is the unit durations are logged in, as a float.
+	// Defaults to time.Millisecond.
+	DurationUnit time.Duration
+
+	// OmitArgs leaves the args out of the logs.
+	OmitArgs bool
+	// RedactArgs replaces the args before they are logged, e.g. to hide passwords.
+	RedactArgs func(query string, args []any) []any
+	// MaxQueryLength truncates longer queries. Zero doesn't truncate.
+	MaxQueryLength int
+
+	// ContextAttrs returns extra attributes from the query's context, such as a request ID.
+	ContextAttrs func(ctx context.Context) []slog.Attr
+	// Group puts the attributes in a group, such as "db". Empty doesn't group them.
+	Group string
+
+	// Interpolate adds an attribute with the args substituted into the
+	// query, quoted for Dialect, so it can be copied into a database client.
+	// It uses the redacted args and is skipped when OmitArgs is set.
+	Interpolate bool
+	Dialect     querypulse.Dialect
+}
+
+// Keys names the attributes logged for each query.
+type Keys struct {
+	Query    string // defaults to "query"
+	Args     string // defaults to "args"
+	Duration string // defaults to "took_" and the unit, such as "took_ms" or "took_us"
+	Error    string // defaults to "error"
+	SQL      string // the interpolated query, defaults to "sql"
+}
+
 // Registers a database driver that logs queries with slog.
 // Uses the provided logger or the slog's default logger.
 // Returns the name of the driver to use.
 func Register(driverName string, log_ *slog.Logger) (string, error) {
+	return RegisterWithOptions(driverName, log_, Options{})
+}
+
+// RegisterWithOptions is like Register but configures the logs with Options.
+func RegisterWithOptions(driverName string, log_ *slog.Logger, opts Options) (string, error) {
+	return querypulse.Register(driverName, NewOptions(log_, opts))
+}
+
+// NewOptions returns querypulse.Options that log with slog, for use with
+// querypulse.Register or querypulse.WrapConnector.
+func NewOptions(log_ *slog.Logger, opts Options) querypulse.Options {
 	log := log_
 	if log == nil {
 		log = slog.Default()
 	}
+	if opts.DurationUnit <= 0 {
+		opts.DurationUnit = time.Millisecond
+	}
+	opts.Keys = opts.Keys.withDefaults(opts.DurationUnit)
+
+	onSuccess := func(ctx context.Context, query string, args []any, duration time.Duration) {
+		level, msg := slog.LevelInfo, "query success"
+		if opts.SlowThreshold > 0 && duration >= opts.SlowThreshold {
+			level, msg = slog.LevelWarn, "slow query"
+		}
+		if !log.Enabled(ctx, level) {
+			return
+		}
+		log.LogAttrs(ctx, level, msg, opts.attrs(ctx, query, args, duration, nil)...)
+	}
+	onError := func(ctx context.Context, query string, args []any, duration time.Duration, err error) {
+		if !log.Enabled(ctx, slog.LevelError) {
+			return
+		}
+		log.LogAttrs(ctx, slog.LevelError, "query error", opts.attrs(ctx, query, args, duration, err)...)
+	}
+	return querypulse.Options{OnSuccess: onSuccess, OnError: onError}
+}
+
+func (k Keys) withDefaults(unit time.Duration) Keys {
+	if k.Query == "" {
+		k.Query = "query"
+	}
+	if k.Args == "" {
+		k.Args = "args"
+	}
+	if k.Duration == "" {
+		k.Duration = durationKey(unit)
+	}
+	if k.Error == "" {
+		k.Error = "error"
+	}
+	if k.SQL == "" {
+		k.SQL = "sql"
+	}
+	return k
+}
 
-	fn := func(ctx context.Context, query string, args []any, duration time.Duration) {
-		log.Info("query success", "query", query, "args", args, "took_ms", duration)
+// durationKey names the duration attribute after its unit.
+func durationKey(unit time.Duration) string {
+	switch unit {
+	case time.Nanosecond:
+		return "took_ns"
+	case time.Microsecond:
+		return "took_us"
+	case time.Millisecond:
+		return "took_ms"
+	case time.Second:
+		return "took_s"
+	}
+	return "took"
+}
+
+func (o *Options) attrs(ctx context.Context, query string, args []any, duration time.Duration, err error) []slog.Attr {
+	attrs := []slog.Attr{slog.String(o.Keys.Query, o.truncate(query))}
+	if !o.OmitArgs {
+		if o.RedactArgs != nil {
+			args = o.RedactArgs(query, args)
+		}
+		attrs = append(attrs, slog.Any(o.Keys.Args, args))
+		if o.Interpolate {
+			attrs = append(attrs, slog.String(o.Keys.SQL, o.truncate(querypulse.Interpolate(query, args, o.Dialect))))
+		}
+	}
+	attrs = append(attrs, slog.Float64(o.Keys.Duration, float64(duration)/float64(o.DurationUnit)))
+	if err != nil {
+		attrs = append(attrs, slog.String(o.Keys.Error, err.Error()))
+	}
+	if o.ContextAttrs != nil {
+		attrs = append(attrs, o.ContextAttrs(ctx)...)
+	}
+	if o.Group != "" {
+		return []slog.Attr{{Key: o.Group, Value: slog.GroupValue(attrs...)}}
+	}
+	return attrs
+}
+
+func (o *Options) truncate(query string) string {
+	if o.MaxQueryLength <= 0 || len(query) <= o.MaxQueryLength {
+		return query
+	}
+	end := o.MaxQueryLength
+	for end > 0 && !utf8.RuneStart(query[end]) {
+		end--
 	}
-	return querypulse.Register(driverName, querypulse.Options{OnSuccess: fn})
+	return query[:end] + "..."
 }
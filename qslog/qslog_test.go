@@ -0,0 +1,128 @@
+package qslog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+type requestIDKey struct{}
+
+func getDB(t *testing.T, opts Options) (*sql.DB, *bytes.Buffer) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	driverName, err := RegisterWithOptions("sqlite3", log, opts)
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	return db, &buf
+}
+
+func lastRecord(t *testing.T, buf *bytes.Buffer) map[string]any {
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(lines[len(lines)-1], &record))
+	return record
+}
+
+func TestRegister(t *testing.T) {
+	db, buf := getDB(t, Options{})
+
+	_, err := db.Exec("select $1", 1)
+	assert.NoError(t, err)
+
+	record := lastRecord(t, buf)
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "query success", record["msg"])
+	assert.Equal(t, "select $1", record["query"])
+	assert.Equal(t, []any{1.0}, record["args"])
+	assert.Less(t, record["took_ms"], 100.0, "took_ms should be in milliseconds")
+}
+
+func TestRegister_error(t *testing.T) {
+	db, buf := getDB(t, Options{})
+
+	_, err := db.Exec("not a valid statement")
+	assert.Error(t, err)
+
+	record := lastRecord(t, buf)
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "query error", record["msg"])
+	assert.Equal(t, err.Error(), record["error"])
+}
+
+func TestRegister_slow(t *testing.T) {
+	db, buf := getDB(t, Options{SlowThreshold: time.Nanosecond})
+
+	_, err := db.Exec("select 1")
+	assert.NoError(t, err)
+
+	record := lastRecord(t, buf)
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "slow query", record["msg"])
+}
+
+func TestRegister_attributes(t *testing.T) {
+	db, buf := getDB(t, Options{
+		Keys:           Keys{Query: "statement", Duration: "took_us"},
+		DurationUnit:   time.Microsecond,
+		RedactArgs:     func(query string, args []any) []any { return []any{"redacted"} },
+		MaxQueryLength: 8,
+		ContextAttrs: func(ctx context.Context) []slog.Attr {
+			id, _ := ctx.Value(requestIDKey{}).(string)
+			return []slog.Attr{slog.String("request_id", id)}
+		},
+		Group:       "db",
+		Interpolate: true,
+		Dialect:     querypulse.DialectSQLite,
+	})
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc")
+	_, err := db.ExecContext(ctx, "select $1 as password", "secret")
+	assert.NoError(t, err)
+
+	record := lastRecord(t, buf)
+	group, ok := record["db"].(map[string]any)
+	if !assert.True(t, ok, "attributes should be grouped under db") {
+		return
+	}
+	assert.Equal(t, "select $...", group["statement"])
+	assert.Equal(t, []any{"redacted"}, group["args"])
+	assert.Equal(t, "select '...", group["sql"])
+	assert.Equal(t, "abc", group["request_id"])
+	assert.Contains(t, group, "took_us")
+}
+
+func TestRegister_durationUnit(t *testing.T) {
+	db, buf := getDB(t, Options{DurationUnit: time.Second})
+
+	_, err := db.Exec("select 1")
+	assert.NoError(t, err)
+
+	record := lastRecord(t, buf)
+	assert.Contains(t, record, "took_s", "the default key follows the unit")
+	assert.NotContains(t, record, "took_ms")
+}
+
+func TestRegister_omitArgs(t *testing.T) {
+	db, buf := getDB(t, Options{OmitArgs: true, Interpolate: true})
+
+	_, err := db.Exec("select $1", "secret")
+	assert.NoError(t, err)
+
+	record := lastRecord(t, buf)
+	assert.NotContains(t, record, "args")
+	assert.NotContains(t, record, "sql")
+}
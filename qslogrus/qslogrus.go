@@ -0,0 +1,54 @@
+package qslogrus
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stephennancekivell/querypulse"
+	"github.com/stephennancekivell/querypulse/internal/logfields"
+)
+
+// Options configures the logs written by a driver registered with RegisterWithOptions.
+type Options struct {
+	// SlowThreshold logs successful queries taking at least this long at Warn.
+	// Zero disables it.
+	SlowThreshold time.Duration
+}
+
+// Registers a database driver that logs queries with logrus.
+// Uses the provided logger or logrus' standard logger.
+// Returns the name of the driver to use.
+func Register(driverName string, log *logrus.Logger) (string, error) {
+	return RegisterWithOptions(driverName, log, Options{})
+}
+
+// RegisterWithOptions is like Register but configures the logs with Options.
+func RegisterWithOptions(driverName string, log *logrus.Logger, opts Options) (string, error) {
+	return querypulse.Register(driverName, NewOptions(log, opts))
+}
+
+// NewOptions returns querypulse.Options that log with logrus, for use with
+// querypulse.Register or querypulse.WrapConnector.
+func NewOptions(log *logrus.Logger, opts Options) querypulse.Options {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
+	return logfields.NewOptions(opts.SlowThreshold, func(ctx context.Context, level logfields.Level, msg string, fields []logfields.Field, err error) {
+		lfields := make(logrus.Fields, len(fields))
+		for _, f := range fields {
+			lfields[f.Key] = f.Value
+		}
+		entry := log.WithContext(ctx).WithFields(lfields)
+		switch level {
+		case logfields.Warn:
+			entry.Warn(msg)
+		case logfields.Error:
+			entry.WithError(err).Error(msg)
+		default:
+			entry.Info(msg)
+		}
+	})
+}
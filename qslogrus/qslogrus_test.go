@@ -0,0 +1,55 @@
+package qslogrus
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse/internal/logfields/logfieldstest"
+)
+
+func register(t *testing.T, opts Options) (string, *bytes.Buffer) {
+	var buf bytes.Buffer
+	log := logrus.New()
+	log.SetOutput(&buf)
+	log.SetFormatter(&logrus.JSONFormatter{})
+	driverName, err := RegisterWithOptions("sqlite3", log, opts)
+	assert.NoError(t, err)
+	return driverName, &buf
+}
+
+func TestRegister(t *testing.T) {
+	driverName, buf := register(t, Options{})
+	db := logfieldstest.OpenDB(t, driverName)
+
+	_, err := db.Exec("select $1", 1)
+	assert.NoError(t, err)
+	r := logfieldstest.Record(t, buf)
+	assert.Equal(t, "info", r["level"])
+	assert.Equal(t, "query success", r["msg"])
+	assert.Equal(t, "select $1", r["query"])
+	assert.Equal(t, []any{1.0}, r["args"])
+	assert.Contains(t, r, "took_ms")
+
+	_, err = db.Exec("not a valid statement")
+	assert.Error(t, err)
+	r = logfieldstest.Record(t, buf)
+	assert.Equal(t, "error", r["level"])
+	assert.Equal(t, "query error", r["msg"])
+	assert.Equal(t, err.Error(), r["error"])
+}
+
+func TestRegister_slow(t *testing.T) {
+	driverName, buf := register(t, Options{SlowThreshold: time.Nanosecond})
+	db := logfieldstest.OpenDB(t, driverName)
+
+	_, err := db.Exec("select 1")
+	assert.NoError(t, err)
+	r := logfieldstest.Record(t, buf)
+	assert.Equal(t, "warning", r["level"])
+	assert.Equal(t, "slow query", r["msg"])
+}
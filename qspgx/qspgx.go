@@ -0,0 +1,166 @@
+// Package qspgx reports queries run with native pgx connections and pools
+// through querypulse.Options, like queries run through a wrapped database/sql
+// driver.
+//
+//	config, err := pgxpool.ParseConfig(os.Getenv("DATABASE_URL"))
+//	...
+//	config.ConnConfig.Tracer = qspgx.NewTracer(querypulse.Options{Stats: stats, OnEvent: onEvent})
+//	pool, err := pgxpool.NewWithConfig(ctx, config)
+//
+// Use pgx's multitracer to combine it with other tracers. For pgx through
+// database/sql, wrap stdlib.GetConnector with querypulse.WrapConnector instead.
+package qspgx
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+var (
+	_ pgx.QueryTracer    = &Tracer{}
+	_ pgx.BatchTracer    = &Tracer{}
+	_ pgx.CopyFromTracer = &Tracer{}
+)
+
+// Tracer implements pgx's QueryTracer, BatchTracer and CopyFromTracer.
+//
+// Each query is reported as an Event once it finishes. The queries of a batch
+// are reported one after another as their results are read. COPY FROM is
+// reported as a "copy table (columns) from stdin" exec. pgx doesn't say which
+// connection ID or transaction a query is part of, so Event.ConnID and
+// Event.TxID are zero and Event.BackendPID identifies the connection.
+// Options that change or block queries, such as Rewrite and Guard, aren't
+// applied.
+type Tracer struct {
+	options *querypulse.Options
+}
+
+// NewTracer returns a Tracer that reports through options. DriverName
+// defaults to "pgx".
+func NewTracer(options querypulse.Options) *Tracer {
+	if options.DriverName == "" {
+		options.DriverName = "pgx"
+	}
+	return &Tracer{options: &options}
+}
+
+type finishKey struct{}
+
+type batchKey struct{}
+
+// batch reports the queued queries of a batch one at a time.
+type batch struct {
+	queued []*pgx.QueuedQuery
+	conn   *pgx.Conn
+	finish func(err error)
+}
+
+func (t *Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, finish := t.start(ctx, conn, data.SQL, data.Args)
+	return context.WithValue(ctx, finishKey{}, finish)
+}
+
+func (t *Tracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if finish, ok := ctx.Value(finishKey{}).(func(error)); ok {
+		finish(data.Err)
+	}
+}
+
+func (t *Tracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	b := &batch{conn: conn}
+	if data.Batch != nil {
+		b.queued = data.Batch.QueuedQueries
+	}
+	ctx = context.WithValue(ctx, batchKey{}, b)
+	t.next(ctx, b)
+	return ctx
+}
+
+func (t *Tracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	b, ok := ctx.Value(batchKey{}).(*batch)
+	if !ok || b.finish == nil {
+		return
+	}
+	b.finish(data.Err)
+	b.finish = nil
+	t.next(ctx, b)
+}
+
+func (t *Tracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	b, ok := ctx.Value(batchKey{}).(*batch)
+	if !ok || b.finish == nil {
+		return
+	}
+	// the batch failed before this query's result was read
+	b.finish(data.Err)
+	b.finish = nil
+}
+
+// next starts timing the next query of a batch.
+func (t *Tracer) next(ctx context.Context, b *batch) {
+	if len(b.queued) == 0 {
+		return
+	}
+	q := b.queued[0]
+	b.queued = b.queued[1:]
+	_, b.finish = t.start(ctx, b.conn, q.SQL, q.Arguments)
+}
+
+func (t *Tracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	query := "copy " + data.TableName.Sanitize()
+	if len(data.ColumnNames) > 0 {
+		columns := make([]string, len(data.ColumnNames))
+		for i, c := range data.ColumnNames {
+			columns[i] = pgx.Identifier{c}.Sanitize()
+		}
+		query += " (" + strings.Join(columns, ", ") + ")"
+	}
+	query += " from stdin"
+	ctx, finish := t.options.StartQuery(ctx, querypulse.Event{Query: query, Operation: querypulse.OpExec, BackendPID: backendPID(conn)})
+	return context.WithValue(ctx, finishKey{}, finish)
+}
+
+func (t *Tracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	if finish, ok := ctx.Value(finishKey{}).(func(error)); ok {
+		finish(data.Err)
+	}
+}
+
+func (t *Tracer) start(ctx context.Context, conn *pgx.Conn, query string, args []any) (context.Context, func(error)) {
+	return t.options.StartQuery(ctx, querypulse.Event{
+		Query:      query,
+		Args:       args,
+		Operation:  operation(query),
+		BackendPID: backendPID(conn),
+	})
+}
+
+// operation guesses whether a query was run with Query or Exec, as pgx traces
+// both the same way. Queries that return rows are counted as OpQuery.
+func operation(query string) querypulse.Operation {
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 {
+		return querypulse.OpExec
+	}
+	switch fields[0] {
+	case "select", "with", "values", "table", "show", "explain", "fetch":
+		return querypulse.OpQuery
+	}
+	for _, f := range fields {
+		if f == "returning" {
+			return querypulse.OpQuery
+		}
+	}
+	return querypulse.OpExec
+}
+
+func backendPID(conn *pgx.Conn) int64 {
+	if conn == nil || conn.PgConn() == nil {
+		return 0
+	}
+	return int64(conn.PgConn().PID())
+}
@@ -0,0 +1,79 @@
+package qspgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stephennancekivell/querypulse"
+)
+
+func TestTracer_query(t *testing.T) {
+	var events []querypulse.Event
+	stats := querypulse.NewStats()
+	tracer := NewTracer(querypulse.Options{Stats: stats, OnEvent: func(_ context.Context, ev querypulse.Event) { events = append(events, ev) }})
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "select * from users where id = $1", Args: []any{1}})
+	q, ok := querypulse.QueryFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "select * from users where id = ?", q.Fingerprint())
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "update users set name = $1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("failed")})
+
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, querypulse.OpQuery, events[0].Operation)
+		assert.Equal(t, []any{1}, events[0].Args)
+		assert.NoError(t, events[0].Err)
+		assert.Equal(t, querypulse.OpExec, events[1].Operation)
+		assert.EqualError(t, events[1].Err, "failed")
+	}
+	assert.Equal(t, int64(2), stats.Snapshot().Drivers["pgx"].Queries)
+}
+
+func TestTracer_batch(t *testing.T) {
+	var events []querypulse.Event
+	tracer := NewTracer(querypulse.Options{OnEvent: func(_ context.Context, ev querypulse.Event) { events = append(events, ev) }})
+
+	b := &pgx.Batch{}
+	b.Queue("insert into t values ($1)", 1)
+	b.Queue("insert into t values ($1)", 2)
+	b.Queue("select count(*) from t")
+	ctx := tracer.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{Batch: b})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "insert into t values ($1)", Args: []any{1}})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "insert into t values ($1)", Args: []any{2}, Err: errors.New("duplicate")})
+	tracer.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{Err: errors.New("batch closed")})
+
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, []any{1}, events[0].Args)
+		assert.NoError(t, events[0].Err)
+		assert.Equal(t, []any{2}, events[1].Args)
+		assert.EqualError(t, events[1].Err, "duplicate")
+		assert.Equal(t, "select count(*) from t", events[2].Query)
+		assert.EqualError(t, events[2].Err, "batch closed")
+	}
+}
+
+func TestTracer_copyFrom(t *testing.T) {
+	var events []querypulse.Event
+	tracer := NewTracer(querypulse.Options{OnEvent: func(_ context.Context, ev querypulse.Event) { events = append(events, ev) }})
+
+	ctx := tracer.TraceCopyFromStart(context.Background(), nil, pgx.TraceCopyFromStartData{TableName: pgx.Identifier{"public", "users"}, ColumnNames: []string{"id", "name"}})
+	tracer.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{})
+
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, `copy "public"."users" ("id", "name") from stdin`, events[0].Query)
+		assert.Equal(t, querypulse.OpExec, events[0].Operation)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	assert.Equal(t, querypulse.OpQuery, operation("  WITH x AS (select 1) select * from x"))
+	assert.Equal(t, querypulse.OpQuery, operation("insert into t values (1) returning id"))
+	assert.Equal(t, querypulse.OpExec, operation("delete from t"))
+	assert.Equal(t, querypulse.OpExec, operation(""))
+}
@@ -0,0 +1,53 @@
+package qszap
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/stephennancekivell/querypulse"
+	"github.com/stephennancekivell/querypulse/internal/logfields"
+)
+
+// Options configures the logs written by a driver registered with RegisterWithOptions.
+type Options struct {
+	// SlowThreshold logs successful queries taking at least this long at Warn.
+	// Zero disables it.
+	SlowThreshold time.Duration
+}
+
+// Registers a database driver that logs queries with zap.
+// Uses the provided logger or zap's global logger.
+// Returns the name of the driver to use.
+func Register(driverName string, log *zap.Logger) (string, error) {
+	return RegisterWithOptions(driverName, log, Options{})
+}
+
+// RegisterWithOptions is like Register but configures the logs with Options.
+func RegisterWithOptions(driverName string, log *zap.Logger, opts Options) (string, error) {
+	return querypulse.Register(driverName, NewOptions(log, opts))
+}
+
+// NewOptions returns querypulse.Options that log with zap, for use with
+// querypulse.Register or querypulse.WrapConnector.
+func NewOptions(log *zap.Logger, opts Options) querypulse.Options {
+	if log == nil {
+		log = zap.L()
+	}
+
+	return logfields.NewOptions(opts.SlowThreshold, func(ctx context.Context, level logfields.Level, msg string, fields []logfields.Field, err error) {
+		zfields := make([]zap.Field, 0, len(fields)+1)
+		for _, f := range fields {
+			zfields = append(zfields, zap.Any(f.Key, f.Value))
+		}
+		switch level {
+		case logfields.Warn:
+			log.Warn(msg, zfields...)
+		case logfields.Error:
+			log.Error(msg, append(zfields, zap.Error(err))...)
+		default:
+			log.Info(msg, zfields...)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package qszerolog
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+
+	"github.com/stephennancekivell/querypulse"
+	"github.com/stephennancekivell/querypulse/internal/logfields"
+)
+
+// Options configures the logs written by a driver registered with RegisterWithOptions.
+type Options struct {
+	// SlowThreshold logs successful queries taking at least this long at Warn.
+	// Zero disables it.
+	SlowThreshold time.Duration
+}
+
+// Registers a database driver that logs queries with zerolog.
+// Uses the provided logger or zerolog's global logger.
+// Returns the name of the driver to use.
+func Register(driverName string, log *zerolog.Logger) (string, error) {
+	return RegisterWithOptions(driverName, log, Options{})
+}
+
+// RegisterWithOptions is like Register but configures the logs with Options.
+func RegisterWithOptions(driverName string, log *zerolog.Logger, opts Options) (string, error) {
+	return querypulse.Register(driverName, NewOptions(log, opts))
+}
+
+// NewOptions returns querypulse.Options that log with zerolog, for use with
+// querypulse.Register or querypulse.WrapConnector.
+func NewOptions(log *zerolog.Logger, opts Options) querypulse.Options {
+	if log == nil {
+		log = &zlog.Logger
+	}
+
+	return logfields.NewOptions(opts.SlowThreshold, func(ctx context.Context, level logfields.Level, msg string, fields []logfields.Field, err error) {
+		var e *zerolog.Event
+		switch level {
+		case logfields.Warn:
+			e = log.Warn()
+		case logfields.Error:
+			e = log.Error().Err(err)
+		default:
+			e = log.Info()
+		}
+		for _, f := range fields {
+			e = e.Interface(f.Key, f.Value)
+		}
+		e.Msg(msg)
+	})
+}
@@ -0,0 +1,61 @@
+package querypulse
+
+import (
+	"context"
+	"fmt"
+)
+
+type readOnlyKey struct{}
+
+// WithReadOnly marks the context as read-only. Write statements and read-write
+// transactions run with it are rejected with a *ReadOnlyError before they
+// reach the database.
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+// IsReadOnly reports whether the context was marked with WithReadOnly.
+func IsReadOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(readOnlyKey{}).(bool)
+	return v
+}
+
+// ReadOnlyError is returned when a write is attempted with a read-only context.
+type ReadOnlyError struct {
+	Query string
+	// Caller is the file and line that ran the query.
+	Caller string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("querypulse: write in read-only context at %s: %s", e.Caller, e.Query)
+}
+
+// isWrite reports whether any statement in the query writes data or changes the schema.
+func isWrite(query string) bool {
+	for _, stmt := range statements(scan(query, "")) {
+		v, _ := verb(stmt)
+		switch v {
+		case "INSERT", "UPDATE", "DELETE", "MERGE", "REPLACE", "UPSERT", "COPY", "GRANT", "REVOKE":
+			return true
+		}
+		if isDDL(v) {
+			return true
+		}
+		if len(nestedWrites(stmt)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnly rejects write queries run with a read-only context, reporting the
+// violation through the callbacks.
+func (o *Options) readOnly(ctx context.Context, original string, query string, args []any) error {
+	if !IsReadOnly(ctx) || !isWrite(query) {
+		return nil
+	}
+	err := &ReadOnlyError{Query: query, Caller: callSite()}
+	o.report(ctx, Event{Query: query, OriginalQuery: original, Args: args, Err: err})
+	return err
+}
@@ -0,0 +1,81 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsWrite(t *testing.T) {
+	testCases := []struct {
+		query string
+		write bool
+	}{
+		{query: "select * from users", write: false},
+		{query: "select * from users for update", write: false},
+		{query: "select 'delete from users'", write: false},
+		{query: "insert into users values (1)", write: true},
+		{query: "UPDATE users SET age = 1", write: true},
+		{query: "delete from users where id = 1", write: true},
+		{query: "create index on users (age)", write: true},
+		{query: "select 1; drop table users", write: true},
+		{query: "with gone as (delete from users returning id) select * from gone", write: true},
+		{query: "with old as (select id from users) select * from old", write: false},
+		{query: "explain analyze delete from users", write: true},
+		{query: "explain delete from users", write: false},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.query, func(t *testing.T) {
+			assert.Equal(t, v.write, isWrite(v.query))
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	var errs []error
+	driverName, err := Register("sqlite3", Options{
+		OnError: func(ctx context.Context, query string, args []any, duration time.Duration, err error) {
+			errs = append(errs, err)
+		},
+	})
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("create table readonly (id int)")
+	assert.NoError(t, err)
+	defer db.Exec("drop table readonly")
+
+	roCtx := WithReadOnly(ctx)
+
+	_, err = db.ExecContext(roCtx, "insert into readonly values (1)")
+	var roErr *ReadOnlyError
+	assert.True(t, errors.As(err, &roErr), "expected a ReadOnlyError, got %v", err)
+	if roErr != nil {
+		assert.Contains(t, roErr.Caller, "readonly_test.go")
+	}
+	assert.Len(t, errs, 1)
+
+	stmt, err := db.Prepare("insert into readonly values (1)")
+	assert.NoError(t, err)
+	_, err = stmt.ExecContext(roCtx)
+	assert.True(t, errors.As(err, &roErr), "expected a ReadOnlyError, got %v", err)
+
+	var n int
+	assert.NoError(t, db.QueryRowContext(roCtx, "select count(*) from readonly").Scan(&n))
+	assert.Equal(t, 0, n)
+
+	_, err = db.BeginTx(roCtx, nil)
+	assert.True(t, errors.As(err, &roErr), "expected a ReadOnlyError, got %v", err)
+
+	tx, err := db.BeginTx(roCtx, &sql.TxOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback())
+}
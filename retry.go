@@ -0,0 +1,172 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy runs queries again when they fail with a retryable error such as
+// a Postgres serialization failure (40001), deadlock (40P01) or SQLITE_BUSY.
+//
+// Set it on Options.Retry to retry single statements run outside of a
+// transaction, or use RetryTx to retry whole transactions.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a query is run, including the first. Defaults to 3.
+	MaxAttempts int
+	// BaseDelay is the backoff before the second attempt, doubling for each
+	// attempt after that. Defaults to 10ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between attempts. Defaults to 1s.
+	MaxDelay time.Duration
+	// ShouldRetry decides which errors are retried. Defaults to serialization
+	// failures, deadlocks and busy databases. Lost connections aren't retried
+	// by default as the statement would run again on the same broken
+	// connection, while database/sql already retries statements that fail with
+	// driver.ErrBadConn on another one.
+	ShouldRetry func(class ErrorClass) bool
+	// Idempotent decides whether a statement is safe to run again.
+	// Defaults to statements that don't write. Contexts marked with
+	// WithIdempotent are always retried.
+	Idempotent func(query string) bool
+	// ClassifyError classifies the errors RetryTx gets for ShouldRetry, like
+	// Options.ClassifyError does for statements. Defaults to ClassifyError.
+	ClassifyError func(err error) ErrorClass
+}
+
+var operationIDs atomic.Uint64
+
+func nextOperationID() uint64 {
+	return operationIDs.Add(1)
+}
+
+type operationKey struct{}
+
+type operation struct {
+	id      uint64
+	attempt int
+}
+
+func withOperation(ctx context.Context, op operation) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+// operationFrom returns the operation a query belongs to, starting a new one
+// when the context isn't part of a retried transaction.
+func operationFrom(ctx context.Context) operation {
+	if op, ok := ctx.Value(operationKey{}).(operation); ok {
+		return op
+	}
+	return operation{id: nextOperationID(), attempt: 1}
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks queries run with the context as safe to retry even when they write.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) shouldRetry(class ErrorClass) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(class)
+	}
+	switch class.Category {
+	case CategorySerializationFailure, CategoryDeadlock, CategoryBusy:
+		return true
+	}
+	return false
+}
+
+func (p *RetryPolicy) classify(err error) ErrorClass {
+	if p.ClassifyError != nil {
+		return p.ClassifyError(err)
+	}
+	return ClassifyError(err)
+}
+
+func (p *RetryPolicy) idempotent(ctx context.Context, query string) bool {
+	if v, _ := ctx.Value(idempotentKey{}).(bool); v {
+		return true
+	}
+	if p.Idempotent != nil {
+		return p.Idempotent(query)
+	}
+	return !isWrite(query)
+}
+
+// backoff returns the delay before the given attempt using exponential
+// backoff with jitter.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	base, max := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = 10 * time.Millisecond
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	delay := base << (attempt - 2)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// wait sleeps before the given attempt. It returns false without waiting when
+// the context would expire before the attempt could finish.
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	delay := p.backoff(attempt)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// RetryTx runs fn in a transaction, committing when it returns nil. The whole
+// transaction is run again when fn or the commit fails with an error the policy
+// retries. fn must be safe to call more than once.
+//
+// Queries run in each attempt are reported with the same Event.OperationID
+// and their Event.Attempt when db was opened with a querypulse driver.
+func RetryTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, policy RetryPolicy, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	id := nextOperationID()
+	var err error
+	for attempt := 1; attempt <= policy.maxAttempts(); attempt++ {
+		if attempt > 1 && !policy.wait(ctx, attempt) {
+			return err
+		}
+		err = runTx(withOperation(ctx, operation{id: id, attempt: attempt}), db, opts, fn)
+		if err == nil || !policy.shouldRetry(policy.classify(err)) {
+			return err
+		}
+	}
+	return err
+}
+
+func runTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
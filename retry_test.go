@@ -0,0 +1,126 @@
+package querypulse
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func getRetryDB(t *testing.T, policy RetryPolicy) (*sql.DB, *[]Event) {
+	return openDB(t, Options{
+		Retry: &policy,
+		// treat every error as a serialization failure so retries can be tested with sqlite
+		ClassifyError: func(err error) ErrorClass {
+			return ErrorClass{Category: CategorySerializationFailure, Retryable: true}
+		},
+	})
+}
+
+func TestRetry(t *testing.T) {
+	db, events := getRetryDB(t, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	_, err := db.QueryContext(ctx, "select * from missing_table")
+	assert.Error(t, err)
+
+	assert.Len(t, *events, 3)
+	for i, ev := range *events {
+		assert.Equal(t, i+1, ev.Attempt)
+		assert.Equal(t, (*events)[0].OperationID, ev.OperationID)
+	}
+}
+
+func TestRetry_notIdempotent(t *testing.T) {
+	db, events := getRetryDB(t, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	_, err := db.ExecContext(ctx, "insert into missing_table values (1)")
+	assert.Error(t, err)
+	assert.Len(t, *events, 1)
+
+	_, err = db.ExecContext(WithIdempotent(ctx), "insert into missing_table values (1)")
+	assert.Error(t, err)
+	assert.Len(t, *events, 4)
+}
+
+func TestRetry_notInTx(t *testing.T) {
+	db, events := getRetryDB(t, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	tx, err := db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = tx.QueryContext(ctx, "select * from missing_table")
+	assert.Error(t, err)
+	assert.Len(t, *events, 1)
+}
+
+func TestRetry_deadline(t *testing.T) {
+	db, events := getRetryDB(t, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second})
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := db.QueryContext(ctx, "select * from missing_table")
+	assert.Error(t, err)
+	assert.Len(t, *events, 1, "should not retry past the deadline")
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRetry_connectionLost(t *testing.T) {
+	db, events := openDB(t, Options{
+		Retry: &RetryPolicy{BaseDelay: time.Millisecond},
+		ClassifyError: func(err error) ErrorClass {
+			return ErrorClass{Category: CategoryConnectionLost, Retryable: true}
+		},
+	})
+
+	_, err := db.QueryContext(ctx, "select * from missing_table")
+	assert.Error(t, err)
+	assert.Len(t, *events, 1, "a lost connection isn't retried on the same connection")
+}
+
+func TestRetryTx(t *testing.T) {
+	db, events := getRetryDB(t, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	calls := 0
+	err := RetryTx(ctx, db, nil, RetryPolicy{BaseDelay: time.Millisecond}, func(ctx context.Context, tx *sql.Tx) error {
+		calls++
+		if _, err := tx.ExecContext(ctx, "select 1"); err != nil {
+			return err
+		}
+		if calls == 1 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	assert.Len(t, *events, 2)
+	assert.Equal(t, 1, (*events)[0].Attempt)
+	assert.Equal(t, 2, (*events)[1].Attempt)
+	assert.Equal(t, (*events)[0].OperationID, (*events)[1].OperationID)
+}
+
+func TestRetryTx_classifyError(t *testing.T) {
+	db, _ := openDB(t, Options{})
+
+	calls := 0
+	policy := RetryPolicy{
+		BaseDelay: time.Millisecond,
+		ClassifyError: func(err error) ErrorClass {
+			return ErrorClass{Category: CategorySerializationFailure, Retryable: true}
+		},
+	}
+	err := RetryTx(ctx, db, nil, policy, func(ctx context.Context, tx *sql.Tx) error {
+		calls++
+		_, err := tx.ExecContext(ctx, "select * from missing_table")
+		return err
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+}
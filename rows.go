@@ -0,0 +1,101 @@
+package querypulse
+
+import (
+	"database/sql/driver"
+	"io"
+	"reflect"
+)
+
+var (
+	_ driver.Rows                           = &zRows{}
+	_ driver.RowsNextResultSet              = &zRows{}
+	_ driver.RowsColumnTypeScanType         = &zRows{}
+	_ driver.RowsColumnTypeDatabaseTypeName = &zRows{}
+	_ driver.RowsColumnTypeLength           = &zRows{}
+	_ driver.RowsColumnTypeNullable         = &zRows{}
+	_ driver.RowsColumnTypePrecisionScale   = &zRows{}
+)
+
+// zRows implements driver.Rows. It implements every optional Rows interface,
+// falling back to what database/sql does when the parent doesn't, so wrapping
+// never changes what the application sees.
+type zRows struct {
+	parent driver.Rows
+	// onClose is called once with the number of rows read.
+	onClose func(rows int)
+	rows    int
+}
+
+func wrapRows(parent driver.Rows, onClose func(rows int)) driver.Rows {
+	return &zRows{parent: parent, onClose: onClose}
+}
+
+func (r *zRows) Columns() []string {
+	return r.parent.Columns()
+}
+
+func (r *zRows) Close() error {
+	err := r.parent.Close()
+	if r.onClose != nil {
+		r.onClose(r.rows)
+		r.onClose = nil
+	}
+	return err
+}
+
+func (r *zRows) Next(dest []driver.Value) error {
+	err := r.parent.Next(dest)
+	if err == nil {
+		r.rows++
+	}
+	return err
+}
+
+func (r *zRows) HasNextResultSet() bool {
+	if n, ok := r.parent.(driver.RowsNextResultSet); ok {
+		return n.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *zRows) NextResultSet() error {
+	if n, ok := r.parent.(driver.RowsNextResultSet); ok {
+		return n.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *zRows) ColumnTypeScanType(index int) reflect.Type {
+	if c, ok := r.parent.(driver.RowsColumnTypeScanType); ok {
+		return c.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func (r *zRows) ColumnTypeDatabaseTypeName(index int) string {
+	if c, ok := r.parent.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return c.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *zRows) ColumnTypeLength(index int) (int64, bool) {
+	if c, ok := r.parent.(driver.RowsColumnTypeLength); ok {
+		return c.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *zRows) ColumnTypeNullable(index int) (bool, bool) {
+	if c, ok := r.parent.(driver.RowsColumnTypeNullable); ok {
+		return c.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *zRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if c, ok := r.parent.(driver.RowsColumnTypePrecisionScale); ok {
+		return c.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
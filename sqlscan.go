@@ -0,0 +1,340 @@
+package querypulse
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind identifies the kind of a token produced by scan.
+type tokenKind int
+
+const (
+	tokWord        tokenKind = iota // keywords and unquoted identifiers
+	tokIdent                        // "quoted" or `quoted` identifiers
+	tokString                       // 'strings', E'strings' and $tag$strings$tag$
+	tokNumber                       // numeric literals
+	tokPlaceholder                  // $1, ?, :name and @name
+	tokPunct                        // operators, parentheses, commas and semicolons
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// is reports whether the token is the given keyword, ignoring case.
+func (t token) is(word string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+// scan splits a query into tokens. Whitespace and comments are dropped.
+// It is deliberately forgiving: it only needs to understand enough SQL to find
+// keywords, literals and placeholders, and never fails on unknown input.
+//
+// Backslashes escape quotes in strings only for DialectMySQL and in Postgres
+// strings like E'\n'. Other dialects, and an unknown one, follow standard SQL.
+func scan(query string, dialect Dialect) []token {
+	var tokens []token
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end + 1
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+			continue
+		case c == '\'':
+			i = scanQuoted(query, i, '\'', dialect == DialectMySQL)
+			tokens = append(tokens, token{kind: tokString, text: query[start:i], pos: start})
+		case (c == 'E' || c == 'e') && i+1 < len(query) && query[i+1] == '\'':
+			i = scanQuoted(query, i+1, '\'', true)
+			tokens = append(tokens, token{kind: tokString, text: query[start:i], pos: start})
+		case (c == 'X' || c == 'x' || c == 'N' || c == 'n') && i+1 < len(query) && query[i+1] == '\'':
+			i = scanQuoted(query, i+1, '\'', dialect == DialectMySQL)
+			tokens = append(tokens, token{kind: tokString, text: query[start:i], pos: start})
+		case c == '"' || c == '`':
+			i = scanQuoted(query, i, c, false)
+			tokens = append(tokens, token{kind: tokIdent, text: query[start:i], pos: start})
+		case c == '$':
+			if i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+				for i < len(query) && isDigit(query[i]) {
+					i++
+				}
+				tokens = append(tokens, token{kind: tokPlaceholder, text: query[start:i], pos: start})
+				continue
+			}
+			if end := dollarTagEnd(query, i); end > 0 {
+				tag := query[i:end]
+				close := strings.Index(query[end:], tag)
+				if close < 0 {
+					i = len(query)
+				} else {
+					i = end + close + len(tag)
+				}
+				tokens = append(tokens, token{kind: tokString, text: query[start:i], pos: start})
+				continue
+			}
+			i++
+			tokens = append(tokens, token{kind: tokPunct, text: "$", pos: start})
+		case c == '?':
+			i++
+			tokens = append(tokens, token{kind: tokPlaceholder, text: "?", pos: start})
+		case (c == ':' || c == '@') && i+1 < len(query) && isIdentStart(query[i+1:]) &&
+			(i == 0 || query[i-1] != c):
+			i++
+			for i < len(query) && isIdentPart(query[i:]) {
+				_, size := utf8.DecodeRuneInString(query[i:])
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokPlaceholder, text: query[start:i], pos: start})
+		case isDigit(c) || (c == '.' && i+1 < len(query) && isDigit(query[i+1])):
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.' || query[i] == 'e' || query[i] == 'E' ||
+				((query[i] == '+' || query[i] == '-') && (query[i-1] == 'e' || query[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: query[start:i], pos: start})
+		case isIdentStart(query[i:]):
+			for i < len(query) && isIdentPart(query[i:]) {
+				_, size := utf8.DecodeRuneInString(query[i:])
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokWord, text: query[start:i], pos: start})
+		default:
+			i++
+			// keep multi character operators such as :: and <= together
+			for i < len(query) && strings.IndexByte("<>=!|&:", query[i]) >= 0 && strings.IndexByte("<>=!|&:", c) >= 0 {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokPunct, text: query[start:i], pos: start})
+		}
+	}
+	return tokens
+}
+
+// scanQuoted returns the index just after the quoted section starting at i.
+// A doubled quote character is an escaped quote, as is one following a
+// backslash when backslash is true.
+func scanQuoted(query string, i int, quote byte, backslash bool) int {
+	i++
+	for i < len(query) {
+		switch query[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+			} else {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return len(query)
+}
+
+// dollarTagEnd returns the end of a $tag$ opening at i, or 0 if there isn't one.
+func dollarTagEnd(query string, i int) int {
+	for j := i + 1; j < len(query); j++ {
+		if query[j] == '$' {
+			return j + 1
+		}
+		if !isIdentPart(query[j:]) {
+			return 0
+		}
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// statements splits tokens into statements on semicolons, dropping empty ones.
+func statements(tokens []token) [][]token {
+	var out [][]token
+	start := 0
+	for i, t := range tokens {
+		if t.kind == tokPunct && t.text == ";" {
+			if i > start {
+				out = append(out, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		out = append(out, tokens[start:])
+	}
+	return out
+}
+
+// verb returns the upper cased keyword saying what a statement does, such as
+// SELECT or UPDATE, and its index. Common table expressions are skipped so
+// "WITH x AS (...) DELETE ..." is a DELETE, as is "EXPLAIN ANALYZE DELETE ..."
+// because it runs the DELETE.
+func verb(stmt []token) (string, int) {
+	if len(stmt) > 0 && stmt[0].is("EXPLAIN") {
+		if rest, analyze := explained(stmt[1:]); analyze {
+			v, i := verb(rest)
+			if i >= 0 {
+				i += len(stmt) - len(rest)
+			}
+			return v, i
+		}
+	}
+	depth := 0
+	for i, t := range stmt {
+		switch {
+		case t.kind == tokPunct && t.text == "(":
+			depth++
+		case t.kind == tokPunct && t.text == ")":
+			depth--
+		case depth == 0 && t.kind == tokWord:
+			if i == 0 && t.is("WITH") {
+				continue
+			}
+			if i > 0 && stmt[0].is("WITH") && !isVerb(t.text) {
+				continue
+			}
+			return strings.ToUpper(t.text), i
+		}
+	}
+	return "", -1
+}
+
+// explained returns the statement following the options of an EXPLAIN and
+// whether the options include ANALYZE, which runs the statement.
+func explained(stmt []token) ([]token, bool) {
+	analyze := false
+	i := 0
+	if i < len(stmt) && (stmt[i].is("ANALYZE") || stmt[i].is("ANALYSE")) {
+		analyze = true
+		i++
+	} else if i < len(stmt) && stmt[i].kind == tokPunct && stmt[i].text == "(" {
+		end := closing(stmt, i)
+		for j := i + 1; j < end; j++ {
+			if stmt[j].is("ANALYZE") || stmt[j].is("ANALYSE") {
+				analyze = !(j+1 < end && (stmt[j+1].is("FALSE") || stmt[j+1].is("OFF") || stmt[j+1].text == "0"))
+			}
+		}
+		i = end + 1
+	}
+	for i < len(stmt) && stmt[i].is("VERBOSE") {
+		i++
+	}
+	if i > len(stmt) {
+		i = len(stmt)
+	}
+	return stmt[i:], analyze
+}
+
+// closing returns the index of the parenthesis closing the one at open, or
+// len(stmt) if it isn't closed.
+func closing(stmt []token, open int) int {
+	depth := 0
+	for i := open; i < len(stmt); i++ {
+		if stmt[i].kind != tokPunct {
+			continue
+		}
+		switch stmt[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(stmt)
+}
+
+func isVerb(word string) bool {
+	switch strings.ToUpper(word) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "VALUES", "TABLE":
+		return true
+	}
+	return false
+}
+
+// nestedWrites returns the INSERT, UPDATE and DELETE statements nested in
+// parentheses, such as the data modifying common table expression of
+// "WITH d AS (DELETE FROM t) SELECT ...". Each one ends before its closing
+// parenthesis.
+func nestedWrites(stmt []token) [][]token {
+	var out [][]token
+	for i := 1; i < len(stmt); i++ {
+		if !(stmt[i-1].kind == tokPunct && stmt[i-1].text == "(") ||
+			!(stmt[i].is("INSERT") || stmt[i].is("UPDATE") || stmt[i].is("DELETE")) {
+			continue
+		}
+		out = append(out, stmt[i:closing(stmt, i-1)])
+	}
+	return out
+}
+
+// hasKeyword reports whether any of words appears outside parentheses.
+func hasKeyword(stmt []token, words ...string) bool {
+	depth := 0
+	for _, t := range stmt {
+		switch {
+		case t.kind == tokPunct && t.text == "(":
+			depth++
+		case t.kind == tokPunct && t.text == ")":
+			depth--
+		case depth == 0 && t.kind == tokWord:
+			for _, w := range words {
+				if t.is(w) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// tableAt returns the name of the table starting at i, such as after FROM or
+// JOIN, or "" if there isn't one. Schema qualifiers and quotes are removed.
+func tableAt(stmt []token, i int) string {
+	if i < len(stmt) && stmt[i].is("ONLY") {
+		i++
+	}
+	name := ""
+	for i < len(stmt) && (stmt[i].kind == tokWord || stmt[i].kind == tokIdent) {
+		name = strings.Trim(stmt[i].text, "\"`")
+		if i+1 < len(stmt) && stmt[i+1].kind == tokPunct && stmt[i+1].text == "." {
+			i += 2
+			continue
+		}
+		break
+	}
+	return name
+}
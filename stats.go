@@ -0,0 +1,371 @@
+package querypulse
+
+import (
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts queries and their latency per driver and per Fingerprint.
+// Set it on Options.Stats, sharing one Stats between drivers if you like, and
+// read it with Snapshot or publish it with PublishExpvar.
+type Stats struct {
+	// MaxFingerprints limits how many fingerprints are tracked per driver.
+	// Queries with fingerprints past the limit are counted under "other".
+	// Defaults to 1000.
+	MaxFingerprints int
+
+	mu      sync.Mutex
+	drivers map[string]*driverStats
+}
+
+// NewStats returns an empty Stats.
+func NewStats() *Stats {
+	return &Stats{}
+}
+
+// StatsSnapshot is a copy of the statistics in a Stats, keyed by driver name.
+type StatsSnapshot struct {
+	Drivers map[string]DriverStats `json:"drivers"`
+}
+
+// DriverStats are the statistics for one driver.
+type DriverStats struct {
+	Queries          int64                       `json:"queries"`
+	Errors           int64                       `json:"errors"`
+	InFlight         int64                       `json:"in_flight"`
+	TotalTimeMs      float64                     `json:"total_time_ms"`
+	ErrorsByCategory map[Category]int64          `json:"errors_by_category"`
+	Fingerprints     map[string]FingerprintStats `json:"fingerprints"`
+	// Connections are the open connections, ordered by ID.
+	Connections []ConnStats `json:"connections,omitempty"`
+	// Pool is the last sample of the connection pool taken by SamplePool.
+	Pool *PoolSnapshot `json:"pool,omitempty"`
+}
+
+// ConnStats are the statistics for one open connection.
+type ConnStats struct {
+	ID         uint64    `json:"id"`
+	BackendPID int64     `json:"backend_pid,omitempty"`
+	Queries    int64     `json:"queries"`
+	Errors     int64     `json:"errors"`
+	BusyTimeMs float64   `json:"busy_time_ms"`
+	OpenedAt   time.Time `json:"opened_at"`
+	AgeMs      float64   `json:"age_ms"`
+}
+
+// PoolSnapshot is a sample of sql.DBStats.
+type PoolSnapshot struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitTimeMs         float64 `json:"wait_time_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+// FingerprintStats are the statistics for one Fingerprint. Percentiles are
+// approximate, accurate to within 20%.
+type FingerprintStats struct {
+	Count       int64   `json:"count"`
+	Errors      int64   `json:"errors"`
+	InFlight    int64   `json:"in_flight"`
+	TotalTimeMs float64 `json:"total_time_ms"`
+	MeanMs      float64 `json:"mean_ms"`
+	MaxMs       float64 `json:"max_ms"`
+	P50Ms       float64 `json:"p50_ms"`
+	P95Ms       float64 `json:"p95_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+}
+
+// otherFingerprint collects queries once MaxFingerprints is reached.
+const otherFingerprint = "other"
+
+type driverStats struct {
+	queries      int64
+	errors       int64
+	inFlight     int64
+	total        time.Duration
+	byCategory   map[Category]int64
+	fingerprints map[string]*fingerprintStats
+	conns        map[uint64]*connStats
+	pool         *PoolSnapshot
+}
+
+type connStats struct {
+	backendPID int64
+	queries    int64
+	errors     int64
+	busy       time.Duration
+	opened     time.Time
+}
+
+type fingerprintStats struct {
+	errors   int64
+	inFlight int64
+	latency  histogram
+}
+
+// PublishExpvar publishes the statistics with the expvar package under name,
+// so they are served at /debug/vars. Publishing another Stats under the same
+// name replaces it, such as after the database is opened again. Like
+// expvar.Publish it panics if name is used by something else.
+func (s *Stats) PublishExpvar(name string) {
+	publishedMu.Lock()
+	defer publishedMu.Unlock()
+	if p, ok := published[name]; ok {
+		p.Store(s)
+		return
+	}
+	p := &atomic.Pointer[Stats]{}
+	p.Store(s)
+	expvar.Publish(name, expvar.Func(func() any {
+		return p.Load().Snapshot()
+	}))
+	published[name] = p
+}
+
+var (
+	publishedMu sync.Mutex
+	// published are the Stats published by PublishExpvar, by name.
+	published = map[string]*atomic.Pointer[Stats]{}
+)
+
+// ServeHTTP serves a snapshot of the statistics as JSON, for dashboards such
+// as `querypulse top`.
+//
+//	http.Handle("/debug/querypulse", stats)
+func (s *Stats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Snapshot())
+}
+
+// Snapshot returns a copy of the current statistics.
+func (s *Stats) Snapshot() StatsSnapshot {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := StatsSnapshot{Drivers: make(map[string]DriverStats, len(s.drivers))}
+	for name, d := range s.drivers {
+		ds := DriverStats{
+			Queries:          d.queries,
+			Errors:           d.errors,
+			InFlight:         d.inFlight,
+			TotalTimeMs:      ms(d.total),
+			ErrorsByCategory: make(map[Category]int64, len(d.byCategory)),
+			Fingerprints:     make(map[string]FingerprintStats, len(d.fingerprints)),
+		}
+		for id, c := range d.conns {
+			ds.Connections = append(ds.Connections, ConnStats{
+				ID:         id,
+				BackendPID: c.backendPID,
+				Queries:    c.queries,
+				Errors:     c.errors,
+				BusyTimeMs: ms(c.busy),
+				OpenedAt:   c.opened,
+				AgeMs:      ms(now.Sub(c.opened)),
+			})
+		}
+		sort.Slice(ds.Connections, func(i, j int) bool { return ds.Connections[i].ID < ds.Connections[j].ID })
+		if d.pool != nil {
+			pool := *d.pool
+			ds.Pool = &pool
+		}
+		for c, n := range d.byCategory {
+			ds.ErrorsByCategory[c] = n
+		}
+		for fp, f := range d.fingerprints {
+			ds.Fingerprints[fp] = FingerprintStats{
+				Count:       f.latency.count,
+				Errors:      f.errors,
+				InFlight:    f.inFlight,
+				TotalTimeMs: ms(f.latency.sum),
+				MeanMs:      ms(f.latency.mean()),
+				MaxMs:       ms(f.latency.max),
+				P50Ms:       ms(f.latency.quantile(0.50)),
+				P95Ms:       ms(f.latency.quantile(0.95)),
+				P99Ms:       ms(f.latency.quantile(0.99)),
+			}
+		}
+		snap.Drivers[name] = ds
+	}
+	return snap
+}
+
+// start counts a query as in flight until the returned func is called.
+func (s *Stats) start(driverName string, fingerprint string) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.driver(driverName)
+	f := s.fingerprint(d, fingerprint)
+	d.inFlight++
+	f.inFlight++
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		d.inFlight--
+		f.inFlight--
+	}
+}
+
+func (s *Stats) record(driverName string, ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.driver(driverName)
+	f := s.fingerprint(d, ev.Fingerprint)
+	d.queries++
+	d.total += ev.Duration
+	f.latency.add(ev.Duration)
+	if ev.Err != nil {
+		d.errors++
+		d.byCategory[ev.ErrorClass.Category]++
+		f.errors++
+	}
+	if c, ok := d.conns[ev.ConnID]; ok {
+		c.queries++
+		c.busy += ev.Duration
+		if ev.Err != nil {
+			c.errors++
+		}
+	}
+}
+
+func (s *Stats) connOpened(driverName string, id uint64, backendPID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.driver(driverName).conns[id] = &connStats{backendPID: backendPID, opened: time.Now()}
+}
+
+func (s *Stats) connClosed(driverName string, id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.driver(driverName).conns, id)
+}
+
+func (s *Stats) recordPool(driverName string, stats sql.DBStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.driver(driverName).pool = &PoolSnapshot{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitTimeMs:         ms(stats.WaitDuration),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+func (s *Stats) driver(name string) *driverStats {
+	if s.drivers == nil {
+		s.drivers = map[string]*driverStats{}
+	}
+	d, ok := s.drivers[name]
+	if !ok {
+		d = &driverStats{
+			byCategory:   map[Category]int64{},
+			fingerprints: map[string]*fingerprintStats{},
+			conns:        map[uint64]*connStats{},
+		}
+		s.drivers[name] = d
+	}
+	return d
+}
+
+func (s *Stats) fingerprint(d *driverStats, fingerprint string) *fingerprintStats {
+	f, ok := d.fingerprints[fingerprint]
+	if ok {
+		return f
+	}
+	max := s.MaxFingerprints
+	if max <= 0 {
+		max = 1000
+	}
+	if len(d.fingerprints) >= max {
+		fingerprint = otherFingerprint
+		if f, ok := d.fingerprints[fingerprint]; ok {
+			return f
+		}
+	}
+	f = &fingerprintStats{}
+	d.fingerprints[fingerprint] = f
+	return f
+}
+
+// setDriverName defaults DriverName to the type of the wrapped driver.
+func (o *Options) setDriverName(d any) {
+	if o.DriverName == "" {
+		o.DriverName = fmt.Sprintf("%T", d)
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// histogram approximates a latency distribution with exponential buckets,
+// four per doubling, from 1µs to about an hour.
+type histogram struct {
+	buckets [128]int64
+	count   int64
+	sum     time.Duration
+	max     time.Duration
+}
+
+const histogramBase = time.Microsecond
+
+func (h *histogram) add(d time.Duration) {
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+	i := 0
+	if d > histogramBase {
+		i = int(math.Ceil(4 * math.Log2(float64(d)/float64(histogramBase))))
+	}
+	if i >= len(h.buckets) {
+		i = len(h.buckets) - 1
+	}
+	h.buckets[i]++
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// quantile returns the upper bound of the bucket holding the q quantile, capped at max.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.count)))
+	var seen int64
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			upper := time.Duration(float64(histogramBase) * math.Pow(2, float64(i)/4))
+			if upper > h.max {
+				return h.max
+			}
+			return upper
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,92 @@
+package querypulse
+
+import (
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	stats := NewStats()
+	driverName, err := Register("sqlite3", Options{Stats: stats})
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	for i := 0; i < 3; i++ {
+		_, err = db.Exec("select $1", i)
+		assert.NoError(t, err)
+	}
+	_, err = db.Exec("not a valid statement")
+	assert.Error(t, err)
+
+	snap := stats.Snapshot()
+	d, ok := snap.Drivers["sqlite3"]
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, int64(4), d.Queries)
+	assert.Equal(t, int64(1), d.Errors)
+	assert.Equal(t, int64(0), d.InFlight)
+	assert.Equal(t, map[Category]int64{CategorySyntax: 1}, d.ErrorsByCategory)
+	assert.Greater(t, d.TotalTimeMs, 0.0)
+
+	fp := d.Fingerprints["select ?"]
+	assert.Equal(t, int64(3), fp.Count)
+	assert.Equal(t, int64(0), fp.Errors)
+	assert.LessOrEqual(t, fp.P50Ms, fp.MaxMs)
+	assert.Equal(t, int64(1), d.Fingerprints["not a valid statement"].Errors)
+
+	stats.PublishExpvar("querypulse_test")
+	var published StatsSnapshot
+	assert.NoError(t, json.Unmarshal([]byte(expvar.Get("querypulse_test").String()), &published))
+	assert.Equal(t, int64(4), published.Drivers["sqlite3"].Queries)
+
+	// publishing again replaces the Stats rather than panicking
+	NewStats().PublishExpvar("querypulse_test")
+	published = StatsSnapshot{}
+	assert.NoError(t, json.Unmarshal([]byte(expvar.Get("querypulse_test").String()), &published))
+	assert.Empty(t, published.Drivers)
+}
+
+func TestStats_maxFingerprints(t *testing.T) {
+	stats := &Stats{MaxFingerprints: 1}
+	stats.record("test", Event{Query: "select 1", Fingerprint: "select ?"})
+	stats.record("test", Event{Query: "select 1, 2", Fingerprint: "select ?, ?"})
+	stats.record("test", Event{Query: "select 1, 2, 3", Fingerprint: "select ?, ?, ?"})
+
+	fps := stats.Snapshot().Drivers["test"].Fingerprints
+	assert.Equal(t, int64(1), fps["select ?"].Count)
+	assert.Equal(t, int64(2), fps["other"].Count)
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 100; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+
+	assert.Equal(t, 100*time.Millisecond, h.max)
+	assert.InEpsilon(t, float64(50*time.Millisecond), float64(h.quantile(0.5)), 0.2)
+	assert.InEpsilon(t, float64(99*time.Millisecond), float64(h.quantile(0.99)), 0.2)
+	assert.Equal(t, 100*time.Millisecond, h.quantile(1))
+}
+
+func TestStats_ServeHTTP(t *testing.T) {
+	stats := NewStats()
+	stats.record("test", Event{Query: "select 1", Fingerprint: "select ?"})
+
+	rec := httptest.NewRecorder()
+	stats.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/querypulse", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var snap StatsSnapshot
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snap))
+	assert.Equal(t, int64(1), snap.Drivers["test"].Fingerprints["select ?"].Count)
+}
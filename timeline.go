@@ -0,0 +1,289 @@
+package querypulse
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Timeline records connections, transactions, prepared statements, queries
+// and row iteration so they can be viewed in chrome://tracing or Perfetto. Set
+// it on Options.Timeline and call WriteChromeTrace at the end of a test run or
+// request.
+//
+// Each connection is a track. Transactions are slices on their connection's
+// track with their queries nested inside, and reading the rows of a query is a
+// slice after it. Gaps between slices are time the connection sat in the pool.
+type Timeline struct {
+	// MaxEvents limits how many events are kept. Later events are dropped.
+	// Defaults to 100000.
+	MaxEvents int
+
+	mu      sync.Mutex
+	start   time.Time
+	events  []timelineEvent
+	dropped int
+	conns   map[uint64]time.Time
+	txs     map[uint64]openTx
+}
+
+type timelineEvent struct {
+	name     string
+	category string
+	conn     uint64
+	start    time.Time
+	duration time.Duration
+	instant  bool
+	args     map[string]any
+}
+
+type openTx struct {
+	conn  uint64
+	start time.Time
+}
+
+// NewTimeline returns an empty Timeline.
+func NewTimeline() *Timeline {
+	return &Timeline{}
+}
+
+// Reset drops the events recorded so far. Connections and transactions that
+// are still open are kept, and they and the queries that were running start at
+// the time of the Reset.
+func (t *Timeline) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = nil
+	t.dropped = 0
+	t.start = time.Now()
+}
+
+// WriteChromeTrace writes the timeline as Chrome Trace Event Format JSON.
+// Connections and transactions that are still open end at the time of writing.
+func (t *Timeline) WriteChromeTrace(w io.Writer) error {
+	t.mu.Lock()
+	now := time.Now()
+	events := append([]timelineEvent(nil), t.events...)
+	start, dropped := t.start, t.dropped
+	for id, opened := range t.conns {
+		events = append(events, connEvent(id, opened, now, true))
+	}
+	for id, tx := range t.txs {
+		events = append(events, txEvent(id, tx, now, "open", nil))
+	}
+	t.mu.Unlock()
+
+	// slices that began before a Reset are cut to start at it
+	for i := range events {
+		if ev := &events[i]; ev.start.Before(start) {
+			ev.duration = max(ev.duration-start.Sub(ev.start), 0)
+			ev.start = start
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].start.Equal(events[j].start) {
+			return events[i].start.Before(events[j].start)
+		}
+		// parents before the slices nested in them
+		return events[i].duration > events[j].duration
+	})
+
+	type chromeEvent struct {
+		Name     string         `json:"name"`
+		Category string         `json:"cat,omitempty"`
+		Phase    string         `json:"ph"`
+		TS       float64        `json:"ts"`
+		Duration *float64       `json:"dur,omitempty"`
+		Scope    string         `json:"s,omitempty"`
+		PID      int            `json:"pid"`
+		TID      uint64         `json:"tid"`
+		Args     map[string]any `json:"args,omitempty"`
+	}
+	out := make([]chromeEvent, 0, len(events))
+	named := map[uint64]bool{}
+	for _, ev := range events {
+		if !named[ev.conn] {
+			named[ev.conn] = true
+			out = append(out, chromeEvent{Name: "thread_name", Phase: "M", PID: 1, TID: ev.conn,
+				Args: map[string]any{"name": "conn " + strconv.FormatUint(ev.conn, 10)}})
+		}
+		ce := chromeEvent{Name: ev.name, Category: ev.category, TS: micros(ev.start.Sub(start)), PID: 1, TID: ev.conn, Args: ev.args}
+		if ev.instant {
+			ce.Phase, ce.Scope = "i", "t"
+		} else {
+			dur := micros(ev.duration)
+			ce.Phase, ce.Duration = "X", &dur
+		}
+		out = append(out, ce)
+	}
+
+	trace := struct {
+		TraceEvents     []chromeEvent  `json:"traceEvents"`
+		DisplayTimeUnit string         `json:"displayTimeUnit"`
+		OtherData       map[string]any `json:"otherData,omitempty"`
+	}{TraceEvents: out, DisplayTimeUnit: "ms"}
+	if dropped > 0 {
+		trace.OtherData = map[string]any{"dropped_events": dropped}
+	}
+	return json.NewEncoder(w).Encode(trace)
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+func (t *Timeline) add(ev timelineEvent) {
+	max := t.MaxEvents
+	if max <= 0 {
+		max = 100000
+	}
+	if len(t.events) >= max {
+		t.dropped++
+		return
+	}
+	t.events = append(t.events, ev)
+}
+
+func (t *Timeline) init(now time.Time) {
+	if t.start.IsZero() {
+		t.start = now
+	}
+	if t.conns == nil {
+		t.conns = map[uint64]time.Time{}
+		t.txs = map[uint64]openTx{}
+	}
+}
+
+// The methods below record events from the wrapped driver. They do nothing on a nil Timeline.
+
+func (t *Timeline) connOpened(conn uint64) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init(now)
+	t.conns[conn] = now
+}
+
+func (t *Timeline) connClosed(conn uint64) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init(now)
+	opened, ok := t.conns[conn]
+	if !ok {
+		return
+	}
+	delete(t.conns, conn)
+	t.add(connEvent(conn, opened, now, false))
+}
+
+func connEvent(conn uint64, opened time.Time, end time.Time, open bool) timelineEvent {
+	ev := timelineEvent{name: "connection", category: "connection", conn: conn, start: opened, duration: end.Sub(opened)}
+	if open {
+		ev.args = map[string]any{"open": true}
+	}
+	return ev
+}
+
+func (t *Timeline) txBegan(conn uint64, tx uint64) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init(now)
+	t.txs[tx] = openTx{conn: conn, start: now}
+}
+
+func (t *Timeline) txEnded(tx uint64, outcome string, err error) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init(now)
+	open, ok := t.txs[tx]
+	if !ok {
+		return
+	}
+	delete(t.txs, tx)
+	t.add(txEvent(tx, open, now, outcome, err))
+}
+
+func txEvent(id uint64, tx openTx, end time.Time, outcome string, err error) timelineEvent {
+	args := map[string]any{"tx_id": id, "outcome": outcome}
+	if err != nil {
+		args["error"] = err.Error()
+	}
+	return timelineEvent{name: "transaction", category: "transaction", conn: tx.conn, start: tx.start, duration: end.Sub(tx.start), args: args}
+}
+
+func (t *Timeline) prepared(conn uint64, query string, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	args := map[string]any{"query": query}
+	if err != nil {
+		args["error"] = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init(now)
+	t.add(timelineEvent{name: "prepare " + Fingerprint(query), category: "statement", conn: conn, start: start, duration: now.Sub(start), args: args})
+}
+
+func (t *Timeline) stmtClosed(conn uint64, query string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init(now)
+	t.add(timelineEvent{name: "close statement", category: "statement", conn: conn, start: now, instant: true, args: map[string]any{"query": query}})
+}
+
+func (t *Timeline) query(conn uint64, ev Event, start time.Time) {
+	if t == nil {
+		return
+	}
+	args := map[string]any{"query": ev.Query, "operation": ev.Operation}
+	if ev.TxID != 0 {
+		args["tx_id"] = ev.TxID
+	}
+	if ev.Attempt > 1 {
+		args["attempt"] = ev.Attempt
+	}
+	if ev.Err != nil {
+		args["error"] = ev.Err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init(start)
+	t.add(timelineEvent{name: ev.Fingerprint, category: "query", conn: conn, start: start, duration: ev.Duration, args: args})
+}
+
+func (t *Timeline) rowsClosed(conn uint64, query string, start time.Time, rows int) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init(now)
+	t.add(timelineEvent{name: "rows", category: "rows", conn: conn, start: start, duration: now.Sub(start),
+		args: map[string]any{"query": query, "rows": rows}})
+}
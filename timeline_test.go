@@ -0,0 +1,108 @@
+package querypulse
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeline(t *testing.T) {
+	timeline := NewTimeline()
+	driverName, err := Register("sqlite3", Options{Timeline: timeline})
+	assert.NoError(t, err)
+
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	rows, err := tx.Query("select 1 union all select 2")
+	assert.NoError(t, err)
+	for rows.Next() {
+	}
+	assert.NoError(t, rows.Close())
+	assert.NoError(t, tx.Commit())
+
+	stmt, err := db.Prepare("select $1")
+	assert.NoError(t, err)
+	assert.NoError(t, stmt.Close())
+
+	var buf bytes.Buffer
+	assert.NoError(t, timeline.WriteChromeTrace(&buf))
+	assert.NoError(t, db.Close())
+
+	var trace struct {
+		TraceEvents []struct {
+			Name     string         `json:"name"`
+			Category string         `json:"cat"`
+			Phase    string         `json:"ph"`
+			TS       float64        `json:"ts"`
+			Duration float64        `json:"dur"`
+			TID      uint64         `json:"tid"`
+			Args     map[string]any `json:"args"`
+		} `json:"traceEvents"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+
+	byCategory := map[string]int{}
+	tids := map[uint64]bool{}
+	for _, ev := range trace.TraceEvents {
+		byCategory[ev.Category]++
+		tids[ev.TID] = true
+		switch ev.Category {
+		case "query":
+			assert.Equal(t, "select ? union all select ?", ev.Name)
+			assert.NotNil(t, ev.Args["tx_id"])
+		case "rows":
+			assert.Equal(t, float64(2), ev.Args["rows"])
+		case "transaction":
+			assert.Equal(t, "commit", ev.Args["outcome"])
+		case "connection":
+			assert.Equal(t, true, ev.Args["open"])
+		}
+	}
+	assert.Equal(t, map[string]int{"": 1, "connection": 1, "transaction": 1, "query": 1, "rows": 1, "statement": 2}, byCategory)
+	assert.Len(t, tids, 1)
+}
+
+func TestTimeline_maxEvents(t *testing.T) {
+	timeline := &Timeline{MaxEvents: 1}
+	timeline.query(1, Event{Query: "select 1"}, time.Now())
+	timeline.query(1, Event{Query: "select 2"}, time.Now())
+	assert.Len(t, timeline.events, 1)
+	assert.Equal(t, 1, timeline.dropped)
+
+	timeline.Reset()
+	assert.Empty(t, timeline.events)
+}
+
+func TestTimeline_reset(t *testing.T) {
+	timeline := NewTimeline()
+	began := time.Now()
+	timeline.connOpened(1)
+	time.Sleep(time.Millisecond)
+	timeline.Reset()
+	timeline.query(1, Event{Query: "select 1", Duration: time.Since(began)}, began)
+	timeline.prepared(1, "select 2", began, nil)
+
+	var buf bytes.Buffer
+	assert.NoError(t, timeline.WriteChromeTrace(&buf))
+	var trace struct {
+		TraceEvents []struct {
+			Category string  `json:"cat"`
+			TS       float64 `json:"ts"`
+			Duration float64 `json:"dur"`
+		} `json:"traceEvents"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+	assert.Len(t, trace.TraceEvents, 4)
+	for _, ev := range trace.TraceEvents {
+		assert.GreaterOrEqual(t, ev.TS, 0.0, "%s started before the Reset", ev.Category)
+		assert.GreaterOrEqual(t, ev.Duration, 0.0)
+	}
+}
@@ -0,0 +1,45 @@
+package querypulse
+
+import (
+	"context"
+	"regexp"
+	"time"
+)
+
+// QueryTimeout applies Timeout to queries whose Fingerprint matches Pattern.
+type QueryTimeout struct {
+	Pattern *regexp.Regexp
+	Timeout time.Duration
+}
+
+func (o *Options) hasTimeout() bool {
+	return o.DefaultTimeout > 0 || len(o.Timeouts) > 0
+}
+
+// timeout returns the timeout to use for a query without a deadline, given
+// its fingerprint.
+func (o *Options) timeout(fingerprint string) time.Duration {
+	for _, t := range o.Timeouts {
+		if t.Pattern.MatchString(fingerprint) {
+			return t.Timeout
+		}
+	}
+	return o.DefaultTimeout
+}
+
+// withTimeout gives the context a deadline when it doesn't already have one.
+// The returned timeout is zero when the context was left alone.
+func (o *Options) withTimeout(ctx context.Context, fingerprint string) (context.Context, context.CancelFunc, time.Duration) {
+	if !o.hasTimeout() {
+		return ctx, func() {}, 0
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}, 0
+	}
+	timeout := o.timeout(fingerprint)
+	if timeout <= 0 {
+		return ctx, func() {}, 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, timeout
+}
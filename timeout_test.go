@@ -0,0 +1,65 @@
+package querypulse
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const slowQuery = "with recursive n(i) as (select 1 union all select i + 1 from n) select count(*) from n"
+
+func TestDefaultTimeout(t *testing.T) {
+	db, events := openDB(t, Options{DefaultTimeout: 20 * time.Millisecond})
+
+	_, err := db.Exec(slowQuery)
+	assert.Error(t, err)
+
+	ev := (*events)[len(*events)-1]
+	assert.Equal(t, 20*time.Millisecond, ev.Timeout)
+	assert.True(t, ev.TimedOut, "should be reported as timed out")
+}
+
+func TestDefaultTimeout_rows(t *testing.T) {
+	db, events := openDB(t, Options{DefaultTimeout: time.Second})
+
+	// the injected deadline must outlive QueryContext so the rows can be read
+	rows, err := db.Query("select 1 union all select 2")
+	assert.NoError(t, err)
+	var got []int
+	for rows.Next() {
+		var n int
+		assert.NoError(t, rows.Scan(&n))
+		got = append(got, n)
+	}
+	assert.NoError(t, rows.Err())
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, []int{1, 2}, got)
+	assert.False(t, (*events)[0].TimedOut)
+
+	// contexts with their own deadline are left alone
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err = db.ExecContext(ctx, "select 1")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), (*events)[1].Timeout)
+}
+
+func TestTimeouts_pattern(t *testing.T) {
+	db, events := openDB(t, Options{
+		DefaultTimeout: time.Minute,
+		Timeouts: []QueryTimeout{
+			{Pattern: regexp.MustCompile(`^select \?$`), Timeout: time.Second},
+		},
+	})
+
+	_, err := db.Exec("select 1")
+	assert.NoError(t, err)
+	_, err = db.Exec("select 1, 2")
+	assert.NoError(t, err)
+
+	assert.Equal(t, time.Second, (*events)[0].Timeout)
+	assert.Equal(t, time.Minute, (*events)[1].Timeout)
+}
@@ -0,0 +1,37 @@
+package querypulse
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// Operation is the kind of call the application made to run a query.
+type Operation string
+
+const (
+	OpExec  Operation = "exec"
+	OpQuery Operation = "query"
+)
+
+// instrument calls fn inside a runtime/trace task and region and with pprof
+// labels, when Options.Trace and Options.ProfileLabels ask for them.
+func (o *Options) instrument(ctx context.Context, op Operation, fingerprint string, fn func(ctx context.Context)) {
+	tracing := o.Trace && trace.IsEnabled()
+	if !tracing && !o.ProfileLabels {
+		fn(ctx)
+		return
+	}
+	if tracing {
+		var task *trace.Task
+		ctx, task = trace.NewTask(ctx, "querypulse."+string(op))
+		defer task.End()
+		trace.Log(ctx, "fingerprint", fingerprint)
+		defer trace.StartRegion(ctx, "querypulse."+string(op)).End()
+	}
+	if o.ProfileLabels {
+		pprof.Do(ctx, pprof.Labels("fingerprint", fingerprint, "operation", string(op)), fn)
+		return
+	}
+	fn(ctx)
+}
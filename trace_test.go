@@ -0,0 +1,51 @@
+package querypulse
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"runtime/pprof"
+	"runtime/trace"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileLabels(t *testing.T) {
+	parent := &ctxConn{}
+	conn := WrapConn(parent, Options{ProfileLabels: true}).(*zConn)
+
+	_, err := conn.ExecContext(ctx, "delete from t where id = $1", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}})
+	assert.NoError(t, err)
+
+	fingerprint, _ := pprof.Label(parent.ctx, "fingerprint")
+	assert.Equal(t, "delete from t where id = ?", fingerprint)
+	operation, _ := pprof.Label(parent.ctx, "operation")
+	assert.Equal(t, "exec", operation)
+
+	conn = WrapConn(parent, Options{}).(*zConn)
+	_, err = conn.ExecContext(ctx, "select 1", nil)
+	assert.NoError(t, err)
+	_, ok := pprof.Label(parent.ctx, "fingerprint")
+	assert.False(t, ok)
+}
+
+func TestTrace(t *testing.T) {
+	if trace.IsEnabled() {
+		t.Skip("tracing is already enabled")
+	}
+	var events []Event
+	parent := &ctxConn{}
+	conn := WrapConn(parent, Options{Trace: true, OnEvent: func(_ context.Context, ev Event) { events = append(events, ev) }}).(*zConn)
+
+	var buf bytes.Buffer
+	assert.NoError(t, trace.Start(&buf))
+	_, err := conn.ExecContext(ctx, "select 1", nil)
+	trace.Stop()
+	assert.NoError(t, err)
+
+	assert.Contains(t, buf.String(), "querypulse.exec")
+	assert.Contains(t, buf.String(), "select ?")
+	assert.Len(t, events, 1)
+	assert.Equal(t, OpExec, events[0].Operation)
+}
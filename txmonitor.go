@@ -0,0 +1,200 @@
+package querypulse
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TxMonitor finds transactions that are held open too long, which block
+// vacuum, hold locks and tie up a connection. Set it on Options.Transactions.
+type TxMonitor struct {
+	// MaxDuration reports transactions still open after this long. Zero disables it.
+	MaxDuration time.Duration
+	// MaxIdle reports transactions that run no statements for this long. Zero disables it.
+	MaxIdle time.Duration
+	// MaxStatements limits how many statements are kept for each report.
+	// Defaults to 100.
+	MaxStatements int
+	// OnReport is called for each transaction found. Transactions whose
+	// connection is closed before they are committed or rolled back are always
+	// reported.
+	OnReport func(report TxReport)
+
+	mu   sync.Mutex
+	open map[uint64]*openTransaction
+}
+
+// TxReason is why a transaction was reported.
+type TxReason string
+
+const (
+	// TxLongRunning is for transactions open longer than TxMonitor.MaxDuration.
+	TxLongRunning TxReason = "long_running"
+	// TxIdle is for transactions that ran no statements for TxMonitor.MaxIdle.
+	TxIdle TxReason = "idle"
+	// TxAbandoned is for transactions whose connection was closed before they
+	// were committed or rolled back.
+	TxAbandoned TxReason = "abandoned"
+)
+
+// TxReport describes a transaction found by a TxMonitor.
+type TxReport struct {
+	Reason TxReason
+	TxID   uint64
+	ConnID uint64
+	// Caller is the file and line that began the transaction.
+	Caller string
+	// Statements are the queries run in the transaction so far, oldest first.
+	Statements []string
+	// StatementCount counts all the statements, including those left out of Statements.
+	StatementCount int
+	Elapsed        time.Duration
+	// Idle is how long it's been since the last statement, or since the
+	// transaction began if it hasn't run any.
+	Idle time.Duration
+}
+
+type openTransaction struct {
+	conn       uint64
+	caller     string
+	began      time.Time
+	last       time.Time
+	statements []string
+	count      int
+	timer      *time.Timer
+	idleTimer  *time.Timer
+}
+
+// Open returns the transactions that are open now, oldest first.
+func (m *TxMonitor) Open() []TxReport {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reports := make([]TxReport, 0, len(m.open))
+	for id, tx := range m.open {
+		reports = append(reports, tx.report(id, "", now))
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].TxID < reports[j].TxID })
+	return reports
+}
+
+func (tx *openTransaction) report(id uint64, reason TxReason, now time.Time) TxReport {
+	return TxReport{
+		Reason:         reason,
+		TxID:           id,
+		ConnID:         tx.conn,
+		Caller:         tx.caller,
+		Statements:     append([]string(nil), tx.statements...),
+		StatementCount: tx.count,
+		Elapsed:        now.Sub(tx.began),
+		Idle:           now.Sub(tx.last),
+	}
+}
+
+// The methods below are called by the wrapped driver. They do nothing on a nil TxMonitor.
+
+func (m *TxMonitor) begin(conn uint64, id uint64, caller string) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	tx := &openTransaction{conn: conn, caller: caller, began: now, last: now}
+	if m.MaxDuration > 0 {
+		tx.timer = time.AfterFunc(m.MaxDuration, func() { m.check(id, TxLongRunning) })
+	}
+	if m.MaxIdle > 0 {
+		tx.idleTimer = time.AfterFunc(m.MaxIdle, func() { m.check(id, TxIdle) })
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.open == nil {
+		m.open = map[uint64]*openTransaction{}
+	}
+	m.open[id] = tx
+}
+
+func (m *TxMonitor) statement(id uint64, query string) {
+	if m == nil || id == 0 {
+		return
+	}
+	max := m.MaxStatements
+	if max <= 0 {
+		max = 100
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx, ok := m.open[id]
+	if !ok {
+		return
+	}
+	tx.last = time.Now()
+	tx.count++
+	if len(tx.statements) < max {
+		tx.statements = append(tx.statements, query)
+	}
+	if tx.idleTimer != nil {
+		tx.idleTimer.Reset(m.MaxIdle)
+	}
+}
+
+func (m *TxMonitor) end(id uint64) {
+	if m == nil {
+		return
+	}
+	m.remove(id)
+}
+
+// abandoned reports a transaction whose connection is being closed.
+func (m *TxMonitor) abandoned(id uint64) {
+	if m == nil {
+		return
+	}
+	if tx := m.remove(id); tx != nil {
+		m.report(tx.report(id, TxAbandoned, time.Now()))
+	}
+}
+
+func (m *TxMonitor) remove(id uint64) *openTransaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx, ok := m.open[id]
+	if !ok {
+		return nil
+	}
+	delete(m.open, id)
+	if tx.timer != nil {
+		tx.timer.Stop()
+	}
+	if tx.idleTimer != nil {
+		tx.idleTimer.Stop()
+	}
+	return tx
+}
+
+// check reports a transaction when its timer fires, unless it ended or ran a
+// statement in the meantime.
+func (m *TxMonitor) check(id uint64, reason TxReason) {
+	now := time.Now()
+	m.mu.Lock()
+	tx, ok := m.open[id]
+	if ok && reason == TxIdle && now.Sub(tx.last) < m.MaxIdle {
+		ok = false
+	}
+	var report TxReport
+	if ok {
+		report = tx.report(id, reason, now)
+	}
+	m.mu.Unlock()
+	if ok {
+		m.report(report)
+	}
+}
+
+func (m *TxMonitor) report(report TxReport) {
+	if m.OnReport != nil {
+		m.OnReport(report)
+	}
+}
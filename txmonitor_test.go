@@ -0,0 +1,68 @@
+package querypulse
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxMonitor(t *testing.T) {
+	reports := make(chan TxReport, 2)
+	monitor := &TxMonitor{MaxDuration: 30 * time.Millisecond, MaxIdle: 10 * time.Millisecond, OnReport: func(r TxReport) { reports <- r }}
+	driverName, err := Register("sqlite3", Options{Transactions: monitor})
+	assert.NoError(t, err)
+	db, err := sql.Open(driverName, "file::memory:?cache=shared")
+	assert.NoError(t, err)
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	_, err = tx.Exec("select 1")
+	assert.NoError(t, err)
+	if open := monitor.Open(); assert.Len(t, open, 1) {
+		assert.Equal(t, 1, open[0].StatementCount)
+	}
+
+	var got []TxReport
+	for len(got) < 2 {
+		select {
+		case r := <-reports:
+			got = append(got, r)
+		case <-time.After(time.Second):
+			t.Fatal("transaction wasn't reported")
+		}
+	}
+	assert.Equal(t, TxIdle, got[0].Reason)
+	assert.GreaterOrEqual(t, got[0].Idle, 10*time.Millisecond)
+	assert.Equal(t, TxLongRunning, got[1].Reason)
+	assert.GreaterOrEqual(t, got[1].Elapsed, 30*time.Millisecond)
+	for _, r := range got {
+		assert.Contains(t, r.Caller, "txmonitor_test.go")
+		assert.Equal(t, []string{"select 1"}, r.Statements)
+		assert.NotZero(t, r.TxID)
+		assert.NotZero(t, r.ConnID)
+	}
+
+	assert.NoError(t, tx.Commit())
+	assert.Empty(t, monitor.Open())
+}
+
+func TestTxMonitor_abandoned(t *testing.T) {
+	var reports []TxReport
+	monitor := &TxMonitor{OnReport: func(r TxReport) { reports = append(reports, r) }}
+	conn := WrapConn(&ctxConn{}, Options{Transactions: monitor}).(*zConn)
+
+	_, err := conn.BeginTx(ctx, driver.TxOptions{})
+	assert.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "update t set x = 1", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Close())
+
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, TxAbandoned, reports[0].Reason)
+		assert.Equal(t, []string{"update t set x = 1"}, reports[0].Statements)
+	}
+	assert.Empty(t, monitor.Open())
+}